@@ -14,7 +14,7 @@
  */
 /*
  * Original source via IBM Corp:
- *  https://hyperledger-fabric.readthedocs.io/en/release-1.2/chaincode4ade.html#pulling-it-all-together
+ *  https://hyperledger-fabric.readthedocs.io/en/release-1.4/chaincode4ade.html#pulling-it-all-together
  *
  * Modifications from Xooa:
  *  https://github.com/xooa/samples
@@ -23,71 +23,560 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
 	"github.com/hyperledger/fabric/protos/peer"
 )
 
 var logger = shim.NewLogger("get-setSC")
 
+// chaincodeName and codeVersion identify this smart contract
+const (
+	chaincodeName = "get-set"
+	codeVersion   = "1.1.0"
+)
+
+// configIndex and dataVersionIndex are the composite key object types of the
+// reserved keys under which the configuration passed to Init and the version
+// of the stored data layout are kept
+const (
+	configIndex      = "config"
+	dataVersionIndex = "dataVersion"
+)
+
+// defaultAdminAttribute is the client certificate attribute that, when set to
+// "true", allows an identity to overwrite, delete and transfer keys it does
+// not own and to register schemas, unless another attribute is configured
+const defaultAdminAttribute = "getset.admin"
+
+// Event types reported in the changes of a get-set event. A transaction that
+// both sets and deletes keys is emitted as eventKeysChanged.
+const (
+	eventKeySet      = "KeySet"
+	eventKeyDeleted  = "KeyDeleted"
+	eventKeysChanged = "KeysChanged"
+)
+
+// defaultChunkSize is the size in bytes above which values are split across
+// several state entries, unless another chunk size is configured
+const defaultChunkSize = 512 * 1024
+
+// chunkIndex is the composite key object type of the entries holding the
+// pieces of a chunked value, keyed by asset key and zero padded sequence
+// number. chunkedIndex marks the asset keys whose state entry holds a manifest.
+const (
+	chunkIndex   = "chunk"
+	chunkedIndex = "chunked"
+)
+
+// transientValueKey is the transient map entry holding the private value
+// passed to setPrivate and verifyPrivateHash, so it is not recorded in the
+// transaction proposal
+const transientValueKey = "value"
+
+// Error codes reported in the code field of error responses
+const (
+	errCodeArgCount        = "ARG_COUNT"
+	errCodeInvalidArgument = "INVALID_ARGUMENT"
+	errCodeNotFound        = "NOT_FOUND"
+	errCodeConflict        = "CONFLICT"
+	errCodeForbidden       = "FORBIDDEN"
+	errCodeSchemaViolation = "SCHEMA_VIOLATION"
+	errCodeValueTooLarge   = "VALUE_TOO_LARGE"
+	errCodeUnknownFunction = "UNKNOWN_FUNCTION"
+	errCodeLedger          = "LEDGER_ERROR"
+	errCodeInternal        = "INTERNAL_ERROR"
+)
+
+// Operations accepted by atomic
+const (
+	atomicAssert    = "assert"
+	atomicSet       = "set"
+	atomicDelete    = "delete"
+	atomicIncrement = "increment"
+)
+
+// Modes accepted by increment and decrement. In counterModeDelta each
+// increment is written to its own counterDeltaIndex entry instead of
+// rewriting the value, so concurrent increments of a counter do not conflict.
+const (
+	counterModeValue = "value"
+	counterModeDelta = "delta"
+)
+
+// counterDeltaIndex is the composite key object type of the pending deltas of
+// a counter, keyed by asset key and txID. counterIndex marks the asset keys
+// that have pending deltas.
+const (
+	counterDeltaIndex = "counterDelta"
+	counterIndex      = "counter"
+)
+
+// maxBatchSize caps the number of entries accepted by setMany, getMany and atomic so a
+// single transaction stays within practical proposal and read/write set sizes.
+const maxBatchSize = 500
+
+// maxPageSize caps the page size accepted by listKeys and getRange
+const maxPageSize = 1000
+
+// versionIndex is the composite key object type under which the txID of the
+// last write to each asset key is recorded. Keys written before versions were
+// recorded report unrecordedVersion, so that an empty expected version never
+// matches an existing key.
+const (
+	versionIndex      = "version"
+	unrecordedVersion = "0"
+)
+
+// ownerIndex is the composite key object type under which the owner of each
+// asset key is recorded
+const ownerIndex = "owner"
+
+// expiryIndex is the composite key object type under which the expiry time of
+// each asset key set with a TTL is recorded. expiryOrderIndex entries are keyed
+// by namespace, expiry time and key so purgeExpired can scan the entries of
+// its namespace in expiry order.
+const (
+	expiryIndex      = "expiry"
+	expiryOrderIndex = "expiryOrder"
+)
+
+// schemaIndex is the composite key object type under which the schemas
+// registered through registerSchema are stored, keyed by namespace and key
+// prefix
+const schemaIndex = "schema"
+
+// Simple value types accepted by registerSchema in place of a JSON Schema
+// document. schemaTypeJSONSchema marks a stored full JSON Schema.
+const (
+	schemaTypeString     = "string"
+	schemaTypeNumber     = "number"
+	schemaTypeJSON       = "json"
+	schemaTypeJSONSchema = "jsonSchema"
+)
+
+// compareModeValue and compareModeVersion select what compareAndSet compares
+// the expected argument against
+const (
+	compareModeValue   = "value"
+	compareModeVersion = "version"
+)
+
 // SimpleAsset implements a simple chaincode to manage an asset
 type SimpleAsset struct {
 }
 
+// keyValue is a single entry of the JSON array accepted by setMany. Expiry is
+// an optional TTL or absolute expiry time, as accepted by set.
+type keyValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Expiry string `json:"expiry,omitempty"`
+}
+
+// batchResult is the per-key outcome reported by setMany and getMany. Failed
+// entries carry the status and error code that get would return for the key.
+type batchResult struct {
+	Status  int32  `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// historyEntry is a single modification of a key reported by getHistory.
+// Value is nil when the modification was a delete. Delta is set for the
+// increments of a counter in delta mode, whose Value is the resulting value of
+// the counter. ExpiresAt is the expiry time set by the modification, if any.
+type historyEntry struct {
+	TxId      string  `json:"TxId"`
+	Value     *string `json:"Value"`
+	Timestamp string  `json:"Timestamp"`
+	IsDelete  bool    `json:"IsDelete"`
+	Delta     *int64  `json:"Delta,omitempty"`
+	ExpiresAt string  `json:"ExpiresAt,omitempty"`
+}
+
+// asOfValue is the response payload of getAsOf: the value of a key in effect
+// at a given time or transaction, and the transaction that wrote it
+type asOfValue struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// versionedValue is the response payload of getWithVersion
+type versionedValue struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version string `json:"version"`
+}
+
+// rangeResult is the response payload of getRange. Bookmark is only set for
+// paginated requests and is passed back to fetch the next page.
+type rangeResult struct {
+	Records             []keyValue `json:"records"`
+	FetchedRecordsCount int32      `json:"fetchedRecordsCount"`
+	Bookmark            string     `json:"bookmark"`
+}
+
+// keyListResult is the response payload of listKeys
+type keyListResult struct {
+	Keys                []string `json:"keys"`
+	FetchedRecordsCount int32    `json:"fetchedRecordsCount"`
+	Bookmark            string   `json:"bookmark"`
+}
+
+// schemaDefinition is a schema registered against a key prefix. Schema holds
+// the JSON Schema document when Type is schemaTypeJSONSchema.
+type schemaDefinition struct {
+	Prefix string          `json:"prefix"`
+	Type   string          `json:"type"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// keyOwner identifies the owner of an asset key by the unique id and MSP id
+// of its client certificate, as reported by the client identity library
+type keyOwner struct {
+	ID    string `json:"id"`
+	MSPID string `json:"mspId"`
+}
+
+// callerIdentity is the identity submitting the current transaction
+type callerIdentity struct {
+	keyOwner
+	Admin bool
+}
+
+// purgeResult is the response payload of purgeExpired. More is set when the
+// batch size was reached before every expired entry was purged.
+type purgeResult struct {
+	Purged []string `json:"purged"`
+	More   bool     `json:"more"`
+}
+
+// chaincodeConfig is the configuration passed to Init as a JSON object.
+// Namespace is transparently prepended to every asset key in the world state
+// and to the asset keys held by the version, owner, expiry, chunk, counter and
+// schema records, so that namespaces never share records.
+// MaxValueSize limits the size of values in bytes, zero meaning no limit.
+// Values larger than ChunkSize bytes are split across several state entries.
+// AllowedMSPs, when not empty, restricts the organizations that may invoke
+// the smart contract. AdminAttribute names the certificate attribute marking
+// admins. EventNamePrefix is prepended to the type of every emitted event.
+type chaincodeConfig struct {
+	Namespace       string   `json:"namespace"`
+	MaxValueSize    int      `json:"maxValueSize"`
+	ChunkSize       int      `json:"chunkSize"`
+	AllowedMSPs     []string `json:"allowedMSPs"`
+	AdminAttribute  string   `json:"adminAttribute"`
+	EventNamePrefix string   `json:"eventNamePrefix"`
+}
+
+// chunkManifest is stored at the state entry of a chunked value. It records
+// the number of chunks, the total size and the hex encoded SHA-256 hash used
+// to verify the reassembled value.
+type chunkManifest struct {
+	Chunks int    `json:"chunks"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// privateHashResult is the response payload of verifyPrivateHash
+type privateHashResult struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	Hash       string `json:"hash"`
+	Match      bool   `json:"match"`
+}
+
+// atomicOperation is a single entry of the JSON array accepted by atomic.
+// An assert checks the current value of the key against Value and, when set,
+// whether the key Exists. Set stores Value, delete removes the key and
+// increment adds the integer Delta to the current value.
+type atomicOperation struct {
+	Op     string  `json:"op"`
+	Key    string  `json:"key"`
+	Value  *string `json:"value,omitempty"`
+	Exists *bool   `json:"exists,omitempty"`
+	Delta  int64   `json:"delta,omitempty"`
+}
+
+// errorBody is the JSON document carried in the message of every error
+// response. Code is a stable machine-readable error code, while Message is
+// meant for humans and may change. Function is the name of the invoked
+// chaincode function and Details holds error specific data, if any.
+type errorBody struct {
+	Code     string      `json:"code"`
+	Message  string      `json:"message"`
+	Function string      `json:"function"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// versionInfo is the response payload of getVersion
+type versionInfo struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	DataVersion int    `json:"dataVersion"`
+}
+
+// migrations upgrade the stored data layout one version at a time:
+// migrations[i] migrates data version i to i+1. Init runs the ones that have
+// not been applied yet, so new steps must only ever be appended.
+var migrations = []func(stub shim.ChaincodeStubInterface) error{
+	migrateToVersion1,
+}
+
+// keyChange is a single mutation reported in a get-set event. ValueHash is
+// the hex encoded SHA-256 hash of the new value and is empty for deletes.
+type keyChange struct {
+	Type      string `json:"type"`
+	Key       string `json:"key"`
+	ValueHash string `json:"valueHash,omitempty"`
+}
+
+// changeEvent is the payload of the chaincode event emitted by every
+// transaction that sets or deletes asset keys
+type changeEvent struct {
+	TxId    string      `json:"txId"`
+	MSPID   string      `json:"mspId"`
+	Changes []keyChange `json:"changes"`
+}
+
+// changeRecorder wraps the stub of a transaction to collect the mutations
+// made through putAsset and deleteAsset. Fabric keeps a single event per
+// transaction, so they are emitted together once the function succeeds.
+type changeRecorder struct {
+	shim.ChaincodeStubInterface
+	changes []keyChange
+}
+
 // Init is called during chaincode instantiation to initialize any
 // data. Note that chaincode upgrade also calls this function to reset
 // or to migrate data.
+// An optional JSON configuration such as {"namespace": "app1/"} may be passed
+// as argument; without it the stored configuration is kept. Pending data
+// migrations are run on every instantiation and upgrade.
 func (t *SimpleAsset) Init(stub shim.ChaincodeStubInterface) peer.Response {
 	logger.Debug("Init() called.")
+	return withFunction("init", t.init(stub))
+}
+
+// init stores the configuration and migrates the data on behalf of Init
+func (t *SimpleAsset) init(stub shim.ChaincodeStubInterface) peer.Response {
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) > 1 {
+		logger.Error("Incorrect number of arguments passed in Init.")
+		return argCountError("0 or 1", len(args))
+	}
+
+	if len(args) == 1 {
+		var config chaincodeConfig
+		if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+			logger.Error("Error occured while parsing Init configuration: ", err)
+			return errorResponse(400, errCodeInvalidArgument, "Configuration must be a JSON object: "+err.Error(), nil)
+		}
+		if config.MaxValueSize < 0 || config.ChunkSize < 0 {
+			return errorResponse(400, errCodeInvalidArgument, "maxValueSize and chunkSize must not be negative.", nil)
+		}
+		err := putConfig(stub, config)
+		if err != nil {
+			logger.Error("Error occured while storing configuration: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to store configuration.", nil)
+		}
+	}
+
+	version, err := getDataVersion(stub)
+	if err != nil {
+		logger.Error("Error occured while reading data version: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read data version.", nil)
+	}
+	for ; version < len(migrations); version++ {
+		logger.Info("Migrating data to version ", version+1)
+		err = migrations[version](stub)
+		if err != nil {
+			logger.Error("Error occured while migrating data to version ", version+1, ": ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to migrate data to version "+strconv.Itoa(version+1)+".", nil)
+		}
+	}
+	err = putDataVersion(stub, version)
+	if err != nil {
+		logger.Error("Error occured while storing data version: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to store data version.", nil)
+	}
 	return shim.Success(nil)
 }
 
 // Invoke is called per transaction on the chaincode. Each transaction is
 // either a 'get' or a 'set' on the asset created by Init function. The Set
-// method may create a new asset by specifying a new key-value pair.
+// method may create a new asset by specifying a new key-value pair. Every
+// successful transaction that sets or deletes keys emits a chaincode event.
+// Errors are returned as a JSON errorBody naming the invoked function.
 func (t *SimpleAsset) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 	logger.Debug("Invoke() called.")
 	// Extract the function and args from the transaction proposal
 	fn, args := stub.GetFunctionAndParameters()
 
+	if resp, ok := checkAllowedMSP(stub); !ok {
+		return withFunction(fn, resp)
+	}
+
+	recorder := &changeRecorder{ChaincodeStubInterface: stub}
+	resp := t.dispatch(recorder, fn, args)
+	if resp.Status != shim.OK || len(recorder.changes) == 0 {
+		return withFunction(fn, resp)
+	}
+
+	err := emitChanges(stub, recorder.changes)
+	if err != nil {
+		logger.Error("Error occured while emitting event: ", err)
+		return withFunction(fn, errorResponse(shim.ERROR, errCodeLedger, "Failed to emit event.", nil))
+	}
+	return resp
+}
+
+// dispatch calls the chaincode function requested by the transaction
+func (t *SimpleAsset) dispatch(stub shim.ChaincodeStubInterface, fn string, args []string) peer.Response {
 	if fn == "set" {
 		return t.set(stub, args)
 	} else if fn == "get" {
 		return t.get(stub, args)
+	} else if fn == "delete" {
+		return t.delete(stub, args)
+	} else if fn == "getHistory" {
+		return t.getHistory(stub, args)
+	} else if fn == "getAsOf" {
+		return t.getAsOf(stub, args)
+	} else if fn == "compareAndSet" {
+		return t.compareAndSet(stub, args)
+	} else if fn == "getWithVersion" {
+		return t.getWithVersion(stub, args)
+	} else if fn == "listKeys" {
+		return t.listKeys(stub, args)
+	} else if fn == "getRange" {
+		return t.getRange(stub, args)
+	} else if fn == "registerSchema" {
+		return t.registerSchema(stub, args)
+	} else if fn == "transferKeyOwnership" {
+		return t.transferKeyOwnership(stub, args)
+	} else if fn == "getOwner" {
+		return t.getOwner(stub, args)
+	} else if fn == "purgeExpired" {
+		return t.purgeExpired(stub, args)
+	} else if fn == "setPrivate" {
+		return t.setPrivate(stub, args)
+	} else if fn == "getPrivate" {
+		return t.getPrivate(stub, args)
+	} else if fn == "verifyPrivateHash" {
+		return t.verifyPrivateHash(stub, args)
+	} else if fn == "increment" {
+		return t.increment(stub, fn, args, 1)
+	} else if fn == "decrement" {
+		return t.increment(stub, fn, args, -1)
+	} else if fn == "atomic" {
+		return t.atomic(stub, args)
+	} else if fn == "setMany" {
+		return t.setMany(stub, args)
+	} else if fn == "getMany" {
+		return t.getMany(stub, args)
 	} else if fn == "getVersion" {
 		return t.getVersion(stub)
 	}
 
 	logger.Error("Function declaration not found for ", fn)
-	resp := shim.Error("Invalid function name : " + fn)
-	resp.Status = 404
-	return resp
+	return errorResponse(404, errCodeUnknownFunction, "Invalid function name : "+fn, nil)
 }
 
-// getVersion retrieves the name and version of this smart contract
+// getVersion retrieves the name and version of this smart contract together
+// with the version of the stored data layout
 func (t *SimpleAsset) getVersion(stub shim.ChaincodeStubInterface) peer.Response {
 	logger.Debug("getVersion called.")
 
-	return shim.Success([]byte("get-set:1.0.0"))
+	version, err := getDataVersion(stub)
+	if err != nil {
+		logger.Error("Error occured while reading data version: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read data version.", nil)
+	}
+	versionAsBytes, err := json.Marshal(versionInfo{Name: chaincodeName, Version: codeVersion, DataVersion: version})
+	if err != nil {
+		logger.Error("Error occured while marshalling version: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal version.", nil)
+	}
+	return shim.Success(versionAsBytes)
 }
 
 // Set stores the asset (both key and value) on the ledger. If the key exists,
-// it will override the value with the new one
+// it will override the value with the new one. An optional third argument sets
+// a TTL (such as "30m" or a number of seconds) or an absolute RFC 3339 expiry
+// time after which the asset is no longer readable.
 func (t *SimpleAsset) set(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	logger.Debug("set() called.")
-	if len(args) != 2 {
+	if len(args) != 2 && len(args) != 3 {
 		logger.Error("Incorrect number of arguments passed in set.")
-		resp := shim.Error("Incorrect number of arguments. Expecting 2 arguments: " + strconv.Itoa(len(args)) + " given.")
-		resp.Status = 400
+		return argCountError("2 or 3", len(args))
+	}
+
+	var expiresAt time.Time
+	if len(args) == 3 {
+		now, err := getTxTime(stub)
+		if err != nil {
+			logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to get transaction timestamp.", nil)
+		}
+		expiresAt, err = parseExpiry(args[2], now)
+		if err != nil {
+			return errorResponse(400, errCodeInvalidArgument, err.Error(), nil)
+		}
+	}
+
+	schemas, err := loadSchemas(stub)
+	if err != nil {
+		logger.Error("Error occured while loading schemas: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to load schemas.", nil)
+	}
+	if resp, ok := checkSchema(schemas, args[0], args[1]); !ok {
+		return resp
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	if resp, ok := checkValueSize(config, args[0], args[1]); !ok {
 		return resp
 	}
 
-	err := stub.PutState(args[0], []byte(args[1]))
+	caller, err := getCaller(stub)
 	if err != nil {
-		logger.Error("Error occured while calling PutState(): ", err)
-		return shim.Error("Failed to set asset: " + args[0])
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	if resp, ok := checkWriteAccess(stub, caller, args[0]); !ok {
+		return resp
+	}
+
+	err = putAsset(stub, caller, args[0], args[1])
+	if err == nil && !expiresAt.IsZero() {
+		err = putExpiry(stub, args[0], expiresAt)
+	}
+	if err != nil {
+		logger.Error("Error occured while storing asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to set asset: "+args[0], nil)
 	}
 	return shim.Success([]byte(args[0] + ":" + args[1]))
 }
@@ -96,23 +585,2397 @@ func (t *SimpleAsset) set(stub shim.ChaincodeStubInterface, args []string) peer.
 func (t *SimpleAsset) get(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	logger.Debug("get() called.")
 	if len(args) != 1 {
-		resp := shim.Error("Incorrect number of arguments. Expecting 1 arguments: " + strconv.Itoa(len(args)) + " given.")
-		resp.Status = 400
+		return argCountError("1", len(args))
+	}
+
+	value, err := getAsset(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while reading asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+args[0], nil)
+	}
+	if value == nil {
+		logger.Info("No data received for key : ", args[0])
+		return errorResponse(400, errCodeNotFound, "Asset not found: "+args[0], nil)
+	}
+	return shim.Success(value)
+}
+
+// delete removes the specified asset key from the world state. The previous
+// values remain available through getHistory, followed by a delete marker.
+func (t *SimpleAsset) delete(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("delete() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in delete.")
+		return argCountError("1", len(args))
+	}
+
+	value, err := getAsset(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while reading asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+args[0], nil)
+	}
+	if value == nil {
+		logger.Info("No data received for key : ", args[0])
+		return errorResponse(400, errCodeNotFound, "Asset not found: "+args[0], nil)
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	if resp, ok := checkWriteAccess(stub, caller, args[0]); !ok {
+		return resp
+	}
+
+	err = deleteAsset(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while deleting asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to delete asset: "+args[0], nil)
+	}
+	return shim.Success([]byte(args[0]))
+}
+
+// getHistory returns every modification of the specified asset key as a JSON
+// array, including deletes which are reported with IsDelete set and a null value.
+// Chunked values are reassembled and the increments of a counter in delta mode
+// are reported with the resulting value.
+func (t *SimpleAsset) getHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getHistory() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in getHistory.")
+		return argCountError("1", len(args))
+	}
+
+	history, err := getKeyHistory(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while reading history: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get history for asset: "+args[0], nil)
+	}
+
+	historyAsBytes, err := json.Marshal(history)
+	if err != nil {
+		logger.Error("Error occured while marshalling history: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal history for asset: "+args[0], nil)
+	}
+	return shim.Success(historyAsBytes)
+}
+
+// getAsOf returns the value a key had at a point in time, given either as an
+// RFC 3339 timestamp or as a txID, together with the txID that wrote it. It
+// walks the history of the key as reported by getHistory. A key that did not
+// exist yet, was deleted or had expired at that point is reported as not
+// found, with the state in the details of the error.
+func (t *SimpleAsset) getAsOf(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getAsOf() called.")
+	if len(args) != 2 {
+		logger.Error("Incorrect number of arguments passed in getAsOf.")
+		return argCountError("2", len(args))
+	}
+
+	key, at := args[0], args[1]
+	if at == "" {
+		return errorResponse(400, errCodeInvalidArgument, "Timestamp or txID must not be empty.", nil)
+	}
+	// Anything that does not parse as a timestamp is taken for a txID
+	asOf, err := time.Parse(time.RFC3339Nano, at)
+	byTxID := err != nil
+
+	history, err := getKeyHistory(stub, key)
+	if err != nil {
+		logger.Error("Error occured while reading history: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get history for asset: "+key, nil)
+	}
+
+	// The history is walked in ledger order, keeping the last modification
+	// made at or before the requested point
+	var found *historyEntry
+	for i := range history {
+		if !byTxID && entryTime(history[i]).After(asOf) {
+			break
+		}
+		found = &history[i]
+		if byTxID && found.TxId == at {
+			break
+		}
+	}
+
+	if byTxID && (found == nil || found.TxId != at) {
+		logger.Info("Transaction ", at, " did not modify key : ", key)
+		return errorResponse(400, errCodeNotFound, "Transaction "+at+" did not modify asset: "+key,
+			map[string]interface{}{"key": key, "txId": at})
+	}
+	if found == nil {
+		logger.Info("No data received for key : ", key, " as of ", at)
+		return errorResponse(400, errCodeNotFound, "Asset did not exist yet as of "+at+": "+key,
+			map[string]interface{}{"key": key, "asOf": at, "state": "notCreated"})
+	}
+	if found.IsDelete {
+		logger.Info("Key was deleted as of ", at, " : ", key)
+		return errorResponse(400, errCodeNotFound, "Asset was deleted as of "+at+": "+key,
+			map[string]interface{}{"key": key, "asOf": at, "state": "deleted", "txId": found.TxId, "timestamp": found.Timestamp})
+	}
+	if !byTxID && historyExpired(*found, asOf) {
+		logger.Info("Key had expired as of ", at, " : ", key)
+		return errorResponse(400, errCodeNotFound, "Asset had expired as of "+at+": "+key,
+			map[string]interface{}{"key": key, "asOf": at, "state": "expired", "txId": found.TxId, "expiresAt": found.ExpiresAt})
+	}
+
+	resultAsBytes, err := json.Marshal(asOfValue{Key: key, Value: *found.Value, TxId: found.TxId, Timestamp: found.Timestamp, ExpiresAt: found.ExpiresAt})
+	if err != nil {
+		logger.Error("Error occured while marshalling asset: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal asset: "+key, nil)
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// compareAndSet stores a new value for an existing asset key only if the
+// current value (or version) still matches the expected one. It expects the key,
+// the expected value, the new value and optionally the comparison mode, which is
+// either "value" (default) or "version". A mismatch is rejected with status 409.
+// A successful swap keeps the expiry of the key, if it has one.
+func (t *SimpleAsset) compareAndSet(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("compareAndSet() called.")
+	if len(args) != 3 && len(args) != 4 {
+		logger.Error("Incorrect number of arguments passed in compareAndSet.")
+		return argCountError("3 or 4", len(args))
+	}
+
+	key, expected, newValue := args[0], args[1], args[2]
+	mode := compareModeValue
+	if len(args) == 4 {
+		mode = args[3]
+	}
+	if mode != compareModeValue && mode != compareModeVersion {
+		return errorResponse(400, errCodeInvalidArgument, "Invalid comparison mode: "+mode+". Expecting \""+compareModeValue+"\" or \""+compareModeVersion+"\".", nil)
+	}
+
+	value, err := getAsset(stub, key)
+	if err != nil {
+		logger.Error("Error occured while reading asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+key, nil)
+	}
+	if value == nil {
+		logger.Info("No data received for key : ", key)
+		return errorResponse(400, errCodeNotFound, "Asset not found: "+key, nil)
+	}
+
+	current := string(value)
+	if mode == compareModeVersion {
+		current, err = getAssetVersion(stub, key)
+		if err != nil {
+			logger.Error("Error occured while reading asset version: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to get version of asset: "+key, nil)
+		}
+	}
+	if current != expected {
+		logger.Info("compareAndSet rejected for key : ", key)
+		return errorResponse(409, errCodeConflict, "Current "+mode+" of asset "+key+" does not match the expected "+mode+".", nil)
+	}
+
+	schemas, err := loadSchemas(stub)
+	if err != nil {
+		logger.Error("Error occured while loading schemas: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to load schemas.", nil)
+	}
+	if resp, ok := checkSchema(schemas, key, newValue); !ok {
+		return resp
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	if resp, ok := checkValueSize(config, key, newValue); !ok {
 		return resp
 	}
 
-	value, err := stub.GetState(args[0])
+	caller, err := getCaller(stub)
 	if err != nil {
-		logger.Error("Error occured while calling GetState(): ", err)
-		return shim.Error("Failed to get asset: " + args[0])
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	if resp, ok := checkWriteAccess(stub, caller, key); !ok {
+		return resp
+	}
+	expiresAt, err := getExpiry(stub, key)
+	if err != nil {
+		logger.Error("Error occured while reading expiry: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get expiry of asset: "+key, nil)
+	}
+
+	// putAsset clears the expiry, which is restored as the swap only
+	// replaces the value
+	err = putAsset(stub, caller, key, newValue)
+	if err == nil && !expiresAt.IsZero() {
+		err = putExpiry(stub, key, expiresAt)
+	}
+	if err != nil {
+		logger.Error("Error occured while storing asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to set asset: "+key, nil)
+	}
+	return shim.Success([]byte(key + ":" + newValue))
+}
+
+// getWithVersion returns the value of the specified asset key together with
+// its version, the txID of the transaction that last wrote it. Keys written
+// before versions were recorded report version "0".
+func (t *SimpleAsset) getWithVersion(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getWithVersion() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in getWithVersion.")
+		return argCountError("1", len(args))
+	}
+
+	value, err := getAsset(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while reading asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+args[0], nil)
 	}
 	if value == nil {
 		logger.Info("No data received for key : ", args[0])
-		resp := shim.Error("Asset not found: " + args[0])
-		resp.Status = 400
+		return errorResponse(400, errCodeNotFound, "Asset not found: "+args[0], nil)
+	}
+	version, err := getAssetVersion(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while reading asset version: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get version of asset: "+args[0], nil)
+	}
+
+	resultAsBytes, err := json.Marshal(versionedValue{Key: args[0], Value: string(value), Version: version})
+	if err != nil {
+		logger.Error("Error occured while marshalling versioned value: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal asset: "+args[0], nil)
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// listKeys returns the asset keys starting with the given prefix. It expects
+// the prefix (an empty prefix lists every key) and optionally a page size and
+// a bookmark returned by a previous call.
+func (t *SimpleAsset) listKeys(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("listKeys() called.")
+	if len(args) < 1 || len(args) > 3 {
+		logger.Error("Incorrect number of arguments passed in listKeys.")
+		return argCountError("1 to 3", len(args))
+	}
+
+	prefix := args[0]
+	endKey := ""
+	if prefix != "" {
+		endKey = prefix + string(utf8.MaxRune)
+	}
+	result, resp, ok := queryRange(stub, prefix, endKey, args[1:])
+	if !ok {
 		return resp
 	}
-	return shim.Success(value)
+	keyList := keyListResult{Keys: []string{}, FetchedRecordsCount: result.FetchedRecordsCount, Bookmark: result.Bookmark}
+	for _, record := range result.Records {
+		keyList.Keys = append(keyList.Keys, record.Key)
+	}
+	return rangeResponse(keyList)
+}
+
+// getRange returns the assets whose keys fall in the range [startKey, endKey).
+// It expects the start and end keys and optionally a page size and a bookmark
+// returned by a previous call. Empty start or end keys leave the range open.
+func (t *SimpleAsset) getRange(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getRange() called.")
+	if len(args) < 2 || len(args) > 4 {
+		logger.Error("Incorrect number of arguments passed in getRange.")
+		return argCountError("2 to 4", len(args))
+	}
+
+	result, resp, ok := queryRange(stub, args[0], args[1], args[2:])
+	if !ok {
+		return resp
+	}
+	return rangeResponse(result)
+}
+
+// queryRange runs a range query over the asset keys. pageArgs holds the
+// optional page size and bookmark; without a page size the whole range is read.
+// FetchedRecordsCount is the number of records returned, which may be lower
+// than the page size as expired records are left out.
+func queryRange(stub shim.ChaincodeStubInterface, startKey string, endKey string, pageArgs []string) (rangeResult, peer.Response, bool) {
+	result := rangeResult{Records: []keyValue{}}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return result, errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil), false
+	}
+	if config.Namespace != "" {
+		startKey = config.Namespace + startKey
+		if endKey == "" {
+			endKey = config.Namespace + string(utf8.MaxRune)
+		} else {
+			endKey = config.Namespace + endKey
+		}
+	}
+
+	var resultsIterator shim.StateQueryIteratorInterface
+	if len(pageArgs) == 0 {
+		resultsIterator, err = stub.GetStateByRange(startKey, endKey)
+	} else {
+		pageSize, convErr := strconv.Atoi(pageArgs[0])
+		if convErr != nil || pageSize <= 0 || pageSize > maxPageSize {
+			return result, errorResponse(400, errCodeInvalidArgument, "Page size must be a number between 1 and "+strconv.Itoa(maxPageSize)+": "+pageArgs[0]+" given.", nil), false
+		}
+		bookmark := ""
+		if len(pageArgs) > 1 {
+			bookmark = pageArgs[1]
+		}
+
+		var metadata *peer.QueryResponseMetadata
+		resultsIterator, metadata, err = stub.GetStateByRangeWithPagination(startKey, endKey, int32(pageSize), bookmark)
+		if err == nil {
+			result.Bookmark = metadata.Bookmark
+		}
+	}
+	if err != nil {
+		logger.Error("Error occured while calling GetStateByRange(): ", err)
+		return result, errorResponse(shim.ERROR, errCodeLedger, "Failed to get assets in range: "+err.Error(), nil), false
+	}
+	defer resultsIterator.Close()
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return result, errorResponse(shim.ERROR, errCodeLedger, "Failed to get transaction timestamp.", nil), false
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return result, errorResponse(shim.ERROR, errCodeLedger, "Failed to get assets in range: "+err.Error(), nil), false
+		}
+		key := strings.TrimPrefix(queryResponse.Key, config.Namespace)
+		expiresAt, err := getExpiry(stub, key)
+		if err != nil {
+			logger.Error("Error occured while reading expiry: ", err)
+			return result, errorResponse(shim.ERROR, errCodeLedger, "Failed to get assets in range: "+err.Error(), nil), false
+		}
+		if !expiresAt.IsZero() && !now.Before(expiresAt) {
+			continue
+		}
+		value, err := readValue(stub, key, queryResponse.Value)
+		if err == nil {
+			value, err = addCounterDeltas(stub, key, value)
+		}
+		if err != nil {
+			logger.Error("Error occured while reading value: ", err)
+			return result, errorResponse(shim.ERROR, errCodeLedger, "Failed to get assets in range: "+err.Error(), nil), false
+		}
+		result.Records = append(result.Records, keyValue{Key: key, Value: string(value)})
+	}
+	result.FetchedRecordsCount = int32(len(result.Records))
+	return result, peer.Response{}, true
+}
+
+// rangeResponse marshals the result of a range query
+func rangeResponse(result interface{}) peer.Response {
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling range result: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal range result.", nil)
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// registerSchema registers the schema that values of keys starting with a
+// prefix must match. It expects the prefix and either a simple type ("string",
+// "number" or "json") or a JSON Schema document. When several prefixes match a
+// key, the longest one applies. Registering a prefix again replaces its schema.
+// Schemas restrict the values of every writer, so only admins may register them.
+func (t *SimpleAsset) registerSchema(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("registerSchema() called.")
+	if len(args) != 2 {
+		logger.Error("Incorrect number of arguments passed in registerSchema.")
+		return argCountError("2", len(args))
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	if !caller.Admin {
+		logger.Info("registerSchema denied for caller : ", caller.ID)
+		return errorResponse(403, errCodeForbidden, "Only admins may register schemas.", nil)
+	}
+
+	definition := schemaDefinition{Prefix: args[0]}
+	switch args[1] {
+	case schemaTypeString, schemaTypeNumber, schemaTypeJSON:
+		definition.Type = args[1]
+	default:
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(args[1]), &schema); err != nil {
+			return errorResponse(400, errCodeInvalidArgument, "Schema must be \"string\", \"number\", \"json\" or a JSON Schema object: "+err.Error(), nil)
+		}
+		definition.Type = schemaTypeJSONSchema
+		definition.Schema = json.RawMessage(args[1])
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	schemaKey, err := stub.CreateCompositeKey(schemaIndex, []string{config.Namespace, definition.Prefix})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to register schema for prefix: "+definition.Prefix, nil)
+	}
+	definitionAsBytes, err := json.Marshal(definition)
+	if err != nil {
+		logger.Error("Error occured while marshalling schema: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to register schema for prefix: "+definition.Prefix, nil)
+	}
+	err = stub.PutState(schemaKey, definitionAsBytes)
+	if err != nil {
+		logger.Error("Error occured while calling PutState(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to register schema for prefix: "+definition.Prefix, nil)
+	}
+	return shim.Success(definitionAsBytes)
+}
+
+// transferKeyOwnership hands the ownership of an asset key over to another
+// identity. It expects the key, the unique id and the MSP id of the new owner.
+// Only the current owner or an admin may transfer a key.
+func (t *SimpleAsset) transferKeyOwnership(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("transferKeyOwnership() called.")
+	if len(args) != 3 {
+		logger.Error("Incorrect number of arguments passed in transferKeyOwnership.")
+		return argCountError("3", len(args))
+	}
+
+	key := args[0]
+	newOwner := keyOwner{ID: args[1], MSPID: args[2]}
+	if newOwner.ID == "" || newOwner.MSPID == "" {
+		return errorResponse(400, errCodeInvalidArgument, "New owner id and MSP id must not be empty.", nil)
+	}
+
+	value, err := getAsset(stub, key)
+	if err != nil {
+		logger.Error("Error occured while reading asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+key, nil)
+	}
+	if value == nil {
+		logger.Info("No data received for key : ", key)
+		return errorResponse(400, errCodeNotFound, "Asset not found: "+key, nil)
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	if resp, ok := checkWriteAccess(stub, caller, key); !ok {
+		return resp
+	}
+
+	err = putOwner(stub, key, newOwner)
+	if err != nil {
+		logger.Error("Error occured while storing owner: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to transfer ownership of asset: "+key, nil)
+	}
+	return shim.Success([]byte(key))
+}
+
+// getOwner returns the owner of the specified asset key as a JSON object with
+// id and mspId fields
+func (t *SimpleAsset) getOwner(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getOwner() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in getOwner.")
+		return argCountError("1", len(args))
+	}
+
+	owner, err := getKeyOwner(stub, args[0])
+	if err != nil {
+		logger.Error("Error occured while reading owner: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get owner of asset: "+args[0], nil)
+	}
+	if owner == nil {
+		logger.Info("No owner recorded for key : ", args[0])
+		return errorResponse(400, errCodeNotFound, "Owner not found: "+args[0], nil)
+	}
+
+	ownerAsBytes, err := json.Marshal(owner)
+	if err != nil {
+		logger.Error("Error occured while marshalling owner: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get owner of asset: "+args[0], nil)
+	}
+	return shim.Success(ownerAsBytes)
+}
+
+// purgeExpired deletes asset keys whose expiry time has passed, oldest first.
+// It optionally takes the maximum number of keys to delete in this transaction
+// and reports whether more expired keys remain.
+func (t *SimpleAsset) purgeExpired(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("purgeExpired() called.")
+	if len(args) > 1 {
+		logger.Error("Incorrect number of arguments passed in purgeExpired.")
+		return argCountError("0 or 1", len(args))
+	}
+
+	batchSize := maxBatchSize
+	if len(args) == 1 {
+		var err error
+		batchSize, err = strconv.Atoi(args[0])
+		if err != nil || batchSize <= 0 || batchSize > maxBatchSize {
+			return errorResponse(400, errCodeInvalidArgument, "Batch size must be a number between 1 and "+strconv.Itoa(maxBatchSize)+": "+args[0]+" given.", nil)
+		}
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get transaction timestamp.", nil)
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(expiryOrderIndex, []string{config.Namespace})
+	if err != nil {
+		logger.Error("Error occured while calling GetStateByPartialCompositeKey(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read expiry index.", nil)
+	}
+	defer resultsIterator.Close()
+
+	result := purgeResult{Purged: []string{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to read expiry index.", nil)
+		}
+		_, parts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(parts) != 3 {
+			logger.Error("Malformed expiry index entry: ", queryResponse.Key)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to read expiry index.", nil)
+		}
+		indexedAt, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			logger.Error("Malformed expiry index entry: ", queryResponse.Key)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to read expiry index.", nil)
+		}
+		if time.Unix(0, indexedAt).After(now) {
+			break
+		}
+		if len(result.Purged) == batchSize {
+			result.More = true
+			break
+		}
+
+		key := parts[2]
+		expiresAt, err := getExpiry(stub, key)
+		if err != nil {
+			logger.Error("Error occured while reading expiry: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to read expiry of asset: "+key, nil)
+		}
+		if expiresAt.UnixNano() == indexedAt {
+			err = deleteAsset(stub, key)
+			result.Purged = append(result.Purged, key)
+		} else {
+			// the key was rewritten since this entry was indexed
+			err = stub.DelState(queryResponse.Key)
+		}
+		if err != nil {
+			logger.Error("Error occured while purging asset: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to purge asset: "+key, nil)
+		}
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling purge result: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal purge result.", nil)
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// setPrivate stores a value in a private data collection. It expects the
+// collection name and the key; the value is read from the "value" entry of the
+// transient map. Only the hash of the value is recorded on the channel ledger.
+// Private keys are owned like other keys: the owner is recorded in the
+// collection itself and only the owner or an admin may overwrite the value.
+func (t *SimpleAsset) setPrivate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("setPrivate() called.")
+	if len(args) != 2 {
+		logger.Error("Incorrect number of arguments passed in setPrivate.")
+		return argCountError("2", len(args))
+	}
+
+	collection, key := args[0], args[1]
+	if collection == "" || key == "" {
+		return errorResponse(400, errCodeInvalidArgument, "Collection and key must not be empty.", nil)
+	}
+	value, resp, ok := getTransientValue(stub)
+	if !ok {
+		return resp
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	if resp, ok := checkValueSize(config, key, string(value)); !ok {
+		return resp
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	owner, err := getPrivateKeyOwner(stub, collection, key)
+	if err != nil {
+		logger.Error("Error occured while reading owner: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get owner of private asset: "+key, nil)
+	}
+	if resp, ok := checkOwner(caller, owner, key); !ok {
+		return resp
+	}
+
+	err = stub.PutPrivateData(collection, config.Namespace+key, value)
+	if err == nil && owner == nil {
+		err = putPrivateKeyOwner(stub, collection, key, caller.keyOwner)
+	}
+	if err != nil {
+		logger.Error("Error occured while calling PutPrivateData(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to set private asset: "+key, nil)
+	}
+	return shim.Success([]byte(key + ":" + hashValue(string(value))))
+}
+
+// getPrivate returns the value of the specified key in a private data
+// collection. It expects the collection name and the key, and only succeeds
+// on peers of organizations that are members of the collection.
+func (t *SimpleAsset) getPrivate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getPrivate() called.")
+	if len(args) != 2 {
+		logger.Error("Incorrect number of arguments passed in getPrivate.")
+		return argCountError("2", len(args))
+	}
+
+	collection, key := args[0], args[1]
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	value, err := stub.GetPrivateData(collection, config.Namespace+key)
+	if err != nil {
+		logger.Error("Error occured while calling GetPrivateData(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get private asset: "+key, nil)
+	}
+	if value == nil {
+		logger.Info("No private data received for key : ", key)
+		return errorResponse(400, errCodeNotFound, "Private asset not found: "+key, nil)
+	}
+	return shim.Success(value)
+}
+
+// verifyPrivateHash checks a value received off-chain against the hash of a
+// private data collection entry, which every organization on the channel can
+// read. It expects the collection name and the key; the value to check is read
+// from the "value" entry of the transient map.
+func (t *SimpleAsset) verifyPrivateHash(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("verifyPrivateHash() called.")
+	if len(args) != 2 {
+		logger.Error("Incorrect number of arguments passed in verifyPrivateHash.")
+		return argCountError("2", len(args))
+	}
+
+	collection, key := args[0], args[1]
+	value, resp, ok := getTransientValue(stub)
+	if !ok {
+		return resp
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	hash, err := stub.GetPrivateDataHash(collection, config.Namespace+key)
+	if err != nil {
+		logger.Error("Error occured while calling GetPrivateDataHash(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get private asset hash: "+key, nil)
+	}
+	if hash == nil {
+		logger.Info("No private data hash received for key : ", key)
+		return errorResponse(400, errCodeNotFound, "Private asset not found: "+key, nil)
+	}
+
+	result := privateHashResult{Collection: collection, Key: key, Hash: hex.EncodeToString(hash)}
+	result.Match = result.Hash == hashValue(string(value))
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling hash result: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal hash result.", nil)
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// getTransientValue reads the private value passed in the transient map
+func getTransientValue(stub shim.ChaincodeStubInterface) ([]byte, peer.Response, bool) {
+	transientMap, err := stub.GetTransient()
+	if err != nil {
+		logger.Error("Error occured while calling GetTransient(): ", err)
+		return nil, errorResponse(shim.ERROR, errCodeLedger, "Failed to read transient map.", nil), false
+	}
+	value, found := transientMap[transientValueKey]
+	if !found {
+		return nil, errorResponse(400, errCodeInvalidArgument, "Value must be passed in the \""+transientValueKey+"\" entry of the transient map.", nil), false
+	}
+	return value, peer.Response{}, true
+}
+
+// increment adds an integer delta to the value of a counter key, or subtracts
+// it when called as decrement. A missing key counts as 0. By default the new
+// value is written and returned. In delta mode the delta is recorded under its
+// own key without reading the pending deltas, and get adds them up; the next
+// increment in value mode, set or delete folds them back into the value. The
+// stored value must still be an integer. Counters constrained by a schema or
+// a maximum value size are checked against the aggregated value, so their
+// pending deltas are read. Expired keys are rejected in delta mode until they
+// are set again or purged, as purging them would drop the new deltas.
+func (t *SimpleAsset) increment(stub shim.ChaincodeStubInterface, fn string, args []string, sign int64) peer.Response {
+	logger.Debug(fn + "() called.")
+	if len(args) != 2 && len(args) != 3 {
+		logger.Error("Incorrect number of arguments passed in " + fn + ".")
+		return argCountError("2 or 3", len(args))
+	}
+
+	key := args[0]
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || (sign < 0 && delta == math.MinInt64) {
+		return errorResponse(400, errCodeInvalidArgument, "Delta must be an integer: "+args[1], nil)
+	}
+	delta = sign * delta
+	mode := counterModeValue
+	if len(args) == 3 && args[2] != "" {
+		mode = args[2]
+	}
+	if mode != counterModeValue && mode != counterModeDelta {
+		return errorResponse(400, errCodeInvalidArgument, "Invalid mode: "+mode+". Expecting "+counterModeValue+" or "+counterModeDelta+".", nil)
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	if resp, ok := checkWriteAccess(stub, caller, key); !ok {
+		return resp
+	}
+
+	schemas, err := loadSchemas(stub)
+	if err != nil {
+		logger.Error("Error occured while loading schemas: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to load schemas.", nil)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+
+	// In delta mode the pending deltas are only read for constrained
+	// counters, as reading them makes concurrent increments conflict again
+	var value []byte
+	if mode == counterModeDelta {
+		expired, err := isExpired(stub, key)
+		if err != nil {
+			logger.Error("Error occured while reading expiry: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to get expiry of asset: "+key, nil)
+		}
+		if expired {
+			return errorResponse(409, errCodeConflict, "Asset has expired: "+key+". Set it again or purge it before incrementing it in "+counterModeDelta+" mode.", map[string]interface{}{"key": key})
+		}
+		value, err = getStoredValue(stub, key)
+		if err == nil && (matchSchema(schemas, key) != nil || config.MaxValueSize > 0) {
+			value, err = addCounterDeltas(stub, key, value)
+		}
+	} else {
+		value, err = getAsset(stub, key)
+	}
+	if err != nil {
+		logger.Error("Error occured while reading asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+key, nil)
+	}
+	total := int64(0)
+	if value != nil {
+		total, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return errorResponse(409, errCodeConflict, "Current value is not an integer: "+key, nil)
+		}
+	}
+	total, ok := addDelta(total, delta)
+	if !ok {
+		return errorResponse(409, errCodeConflict, "Delta overflows the current value of asset: "+key, nil)
+	}
+	incremented := strconv.FormatInt(total, 10)
+
+	if resp, ok := checkSchema(schemas, key, incremented); !ok {
+		return resp
+	}
+	if resp, ok := checkValueSize(config, key, incremented); !ok {
+		return resp
+	}
+
+	if mode == counterModeDelta {
+		err = putCounterDelta(stub, caller, key, delta)
+		if err != nil {
+			logger.Error("Error occured while storing counter delta: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to "+fn+" asset: "+key, nil)
+		}
+		return shim.Success([]byte(strconv.FormatInt(delta, 10)))
+	}
+	err = putAsset(stub, caller, key, incremented)
+	if err != nil {
+		logger.Error("Error occured while storing asset: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to "+fn+" asset: "+key, nil)
+	}
+	return shim.Success([]byte(incremented))
+}
+
+// addDelta adds delta to total, reporting false if the result overflows
+func addDelta(total int64, delta int64) (int64, bool) {
+	if (delta > 0 && total > math.MaxInt64-delta) || (delta < 0 && total < math.MinInt64-delta) {
+		return total, false
+	}
+	return total + delta, true
+}
+
+// atomic applies a JSON array of assert, set, delete and increment operations
+// in a single transaction. Operations see the effect of the ones before them.
+// Either every operation is applied, or the transaction fails with the index
+// of the first failing operation; a failed assert is reported with status 409.
+func (t *SimpleAsset) atomic(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("atomic() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in atomic.")
+		return argCountError("1", len(args))
+	}
+
+	var operations []atomicOperation
+	if err := json.Unmarshal([]byte(args[0]), &operations); err != nil {
+		logger.Error("Error occured while parsing atomic arguments: ", err)
+		return errorResponse(400, errCodeInvalidArgument, "Argument must be a JSON array of operations: "+err.Error(), nil)
+	}
+	if resp, ok := checkBatchSize(len(operations)); !ok {
+		return resp
+	}
+	schemas, err := loadSchemas(stub)
+	if err != nil {
+		logger.Error("Error occured while loading schemas: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to load schemas.", nil)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+
+	// The world state does not reflect the writes of the current transaction,
+	// so the values written by earlier operations are tracked here. A nil
+	// value marks a deleted key.
+	pending := make(map[string]*string)
+	order := []string{}
+	current := func(key string) (*string, error) {
+		if value, found := pending[key]; found {
+			return value, nil
+		}
+		value, err := getAsset(stub, key)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		stored := string(value)
+		return &stored, nil
+	}
+	write := func(key string, value *string) {
+		if _, found := pending[key]; !found {
+			order = append(order, key)
+		}
+		pending[key] = value
+	}
+	fail := func(index int, operation atomicOperation, resp peer.Response) peer.Response {
+		body := parseError(resp)
+		logger.Info("atomic operation failed at index ", index, ": ", body.Message)
+		details := map[string]interface{}{"index": index, "op": operation.Op, "key": operation.Key}
+		if body.Details != nil {
+			details["cause"] = body.Details
+		}
+		return errorResponse(resp.Status, body.Code, "Operation "+strconv.Itoa(index)+" ("+operation.Op+" "+operation.Key+") failed: "+body.Message, details)
+	}
+
+	for i, operation := range operations {
+		if operation.Key == "" {
+			return fail(i, operation, errorResponse(400, errCodeInvalidArgument, "Key must not be empty.", nil))
+		}
+		value, err := current(operation.Key)
+		if err != nil {
+			logger.Error("Error occured while reading asset: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+operation.Key, nil)
+		}
+
+		switch operation.Op {
+		case atomicAssert:
+			if operation.Value == nil && operation.Exists == nil {
+				return fail(i, operation, errorResponse(400, errCodeInvalidArgument, "An assert must specify a value or whether the key exists.", nil))
+			}
+			if operation.Exists != nil && *operation.Exists != (value != nil) {
+				return fail(i, operation, errorResponse(409, errCodeConflict, "Existence of the key does not match the expected one.", nil))
+			}
+			if operation.Value != nil && (value == nil || *value != *operation.Value) {
+				return fail(i, operation, errorResponse(409, errCodeConflict, "Current value does not match the expected value.", nil))
+			}
+			continue
+		case atomicSet:
+			if operation.Value == nil {
+				return fail(i, operation, errorResponse(400, errCodeInvalidArgument, "A set must specify a value.", nil))
+			}
+			value = operation.Value
+		case atomicDelete:
+			if value == nil {
+				return fail(i, operation, errorResponse(400, errCodeNotFound, "Asset not found.", nil))
+			}
+			value = nil
+		case atomicIncrement:
+			total := int64(0)
+			if value != nil {
+				total, err = strconv.ParseInt(*value, 10, 64)
+				if err != nil {
+					return fail(i, operation, errorResponse(409, errCodeConflict, "Current value is not an integer.", nil))
+				}
+			}
+			total, ok := addDelta(total, operation.Delta)
+			if !ok {
+				return fail(i, operation, errorResponse(409, errCodeConflict, "Increment overflows the current value.", nil))
+			}
+			incremented := strconv.FormatInt(total, 10)
+			value = &incremented
+		default:
+			return fail(i, operation, errorResponse(400, errCodeInvalidArgument, "Unknown operation. Expecting assert, set, delete or increment.", nil))
+		}
+
+		if value != nil {
+			if resp, ok := checkSchema(schemas, operation.Key, *value); !ok {
+				return fail(i, operation, resp)
+			}
+			if resp, ok := checkValueSize(config, operation.Key, *value); !ok {
+				return fail(i, operation, resp)
+			}
+		}
+		if resp, ok := checkWriteAccess(stub, caller, operation.Key); !ok {
+			return fail(i, operation, resp)
+		}
+		write(operation.Key, value)
+	}
+
+	results := make(map[string]batchResult, len(order))
+	for _, key := range order {
+		value := pending[key]
+		if value == nil {
+			err = deleteAsset(stub, key)
+			results[key] = batchResult{Status: shim.OK, Message: "deleted"}
+		} else {
+			err = putAsset(stub, caller, key, *value)
+			results[key] = batchResult{Status: shim.OK, Value: *value}
+		}
+		if err != nil {
+			logger.Error("Error occured while applying atomic operations: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to apply operations on asset: "+key, nil)
+		}
+	}
+	return batchResponse(results)
+}
+
+// setMany stores a batch of key value pairs on the ledger in a single
+// transaction. It expects one argument: a JSON array of {"key","value"} objects.
+// The response is a JSON object mapping every key to its result.
+// A key may appear only once in a batch: a transaction does not read its own
+// writes, so the records of a second write would not see the first one.
+func (t *SimpleAsset) setMany(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("setMany() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in setMany.")
+		return argCountError("1", len(args))
+	}
+
+	var pairs []keyValue
+	if err := json.Unmarshal([]byte(args[0]), &pairs); err != nil {
+		logger.Error("Error occured while parsing setMany arguments: ", err)
+		return errorResponse(400, errCodeInvalidArgument, "Argument must be a JSON array of {\"key\", \"value\"} objects: "+err.Error(), nil)
+	}
+	if resp, ok := checkBatchSize(len(pairs)); !ok {
+		return resp
+	}
+	schemas, err := loadSchemas(stub)
+	if err != nil {
+		logger.Error("Error occured while loading schemas: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to load schemas.", nil)
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil)
+	}
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller identity: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil)
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get transaction timestamp.", nil)
+	}
+	expiries := make([]time.Time, len(pairs))
+	seen := make(map[string]bool, len(pairs))
+	for i, pair := range pairs {
+		if pair.Key == "" {
+			return errorResponse(400, errCodeInvalidArgument, "Key must not be empty at index "+strconv.Itoa(i)+".", map[string]interface{}{"index": i})
+		}
+		if seen[pair.Key] {
+			return errorResponse(400, errCodeInvalidArgument, "Duplicate key "+pair.Key+" at index "+strconv.Itoa(i)+".", map[string]interface{}{"index": i, "key": pair.Key})
+		}
+		seen[pair.Key] = true
+		if pair.Expiry != "" {
+			expiries[i], err = parseExpiry(pair.Expiry, now)
+			if err != nil {
+				return errorResponse(400, errCodeInvalidArgument, err.Error()+" At index "+strconv.Itoa(i)+".", map[string]interface{}{"index": i})
+			}
+		}
+		if resp, ok := checkSchema(schemas, pair.Key, pair.Value); !ok {
+			return resp
+		}
+		if resp, ok := checkValueSize(config, pair.Key, pair.Value); !ok {
+			return resp
+		}
+		if resp, ok := checkWriteAccess(stub, caller, pair.Key); !ok {
+			return resp
+		}
+	}
+
+	results := make(map[string]batchResult, len(pairs))
+	for i, pair := range pairs {
+		err := putAsset(stub, caller, pair.Key, pair.Value)
+		if err == nil && !expiries[i].IsZero() {
+			err = putExpiry(stub, pair.Key, expiries[i])
+		}
+		if err != nil {
+			logger.Error("Error occured while storing asset: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to set asset: "+pair.Key, nil)
+		}
+		results[pair.Key] = batchResult{Status: shim.OK, Value: pair.Value}
+	}
+	return batchResponse(results)
+}
+
+// getMany returns the values of a batch of asset keys. It expects one argument:
+// a JSON array of keys. Keys that do not exist are reported with status 400
+// and code NOT_FOUND, like get, instead of failing the whole batch.
+func (t *SimpleAsset) getMany(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getMany() called.")
+	if len(args) != 1 {
+		logger.Error("Incorrect number of arguments passed in getMany.")
+		return argCountError("1", len(args))
+	}
+
+	var keys []string
+	if err := json.Unmarshal([]byte(args[0]), &keys); err != nil {
+		logger.Error("Error occured while parsing getMany arguments: ", err)
+		return errorResponse(400, errCodeInvalidArgument, "Argument must be a JSON array of keys: "+err.Error(), nil)
+	}
+	if resp, ok := checkBatchSize(len(keys)); !ok {
+		return resp
+	}
+
+	results := make(map[string]batchResult, len(keys))
+	for _, key := range keys {
+		if key == "" {
+			results[key] = batchResult{Status: 400, Code: errCodeInvalidArgument, Message: "Key must not be empty."}
+			continue
+		}
+		value, err := getAsset(stub, key)
+		if err != nil {
+			logger.Error("Error occured while reading asset: ", err)
+			return errorResponse(shim.ERROR, errCodeLedger, "Failed to get asset: "+key, nil)
+		}
+		if value == nil {
+			results[key] = batchResult{Status: 400, Code: errCodeNotFound, Message: "Asset not found: " + key}
+			continue
+		}
+		results[key] = batchResult{Status: shim.OK, Value: string(value)}
+	}
+	return batchResponse(results)
+}
+
+// checkBatchSize rejects empty batches and batches larger than maxBatchSize
+func checkBatchSize(size int) (peer.Response, bool) {
+	if size == 0 || size > maxBatchSize {
+		return errorResponse(400, errCodeInvalidArgument, "Batch must contain between 1 and "+strconv.Itoa(maxBatchSize)+" entries: "+strconv.Itoa(size)+" given.", nil), false
+	}
+	return peer.Response{}, true
+}
+
+// batchResponse marshals the per-key results of a batch operation
+func batchResponse(results map[string]batchResult) peer.Response {
+	resultsAsBytes, err := json.Marshal(results)
+	if err != nil {
+		logger.Error("Error occured while marshalling batch results: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to marshal batch results.", nil)
+	}
+	return shim.Success(resultsAsBytes)
+}
+
+// errorResponse returns an error response with the given status whose message
+// is a JSON errorBody. The function name is filled in by withFunction.
+func errorResponse(status int32, code string, message string, details interface{}) peer.Response {
+	body, err := json.Marshal(errorBody{Code: code, Message: message, Details: details})
+	if err != nil {
+		logger.Error("Error occured while marshalling error body: ", err)
+		body, _ = json.Marshal(errorBody{Code: code, Message: message})
+	}
+	resp := shim.Error(string(body))
+	resp.Status = status
+	return resp
+}
+
+// argCountError returns the error response for an unexpected number of
+// arguments
+func argCountError(expected string, given int) peer.Response {
+	return errorResponse(400, errCodeArgCount, "Incorrect number of arguments. Expecting "+expected+" arguments: "+strconv.Itoa(given)+" given.",
+		map[string]interface{}{"expected": expected, "given": given})
+}
+
+// parseError decodes the errorBody of an error response. Messages that are
+// not an errorBody are reported as internal errors.
+func parseError(resp peer.Response) errorBody {
+	var body errorBody
+	if err := json.Unmarshal([]byte(resp.Message), &body); err != nil || body.Code == "" {
+		return errorBody{Code: errCodeInternal, Message: resp.Message}
+	}
+	return body
+}
+
+// withFunction sets the name of the invoked function in the errorBody of an
+// error response. Successful responses are returned unchanged.
+func withFunction(fn string, resp peer.Response) peer.Response {
+	if resp.Status < shim.ERRORTHRESHOLD {
+		return resp
+	}
+	body := parseError(resp)
+	body.Function = fn
+	message, err := json.Marshal(body)
+	if err != nil {
+		logger.Error("Error occured while marshalling error body: ", err)
+		return resp
+	}
+	resp.Message = string(message)
+	return resp
+}
+
+// getAsset reads the value of an asset key, returning nil if the key does
+// not exist or has expired. Pending deltas of a counter are added to the value.
+func getAsset(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+	value, err := getStoredValue(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	return addCounterDeltas(stub, key, value)
+}
+
+// getStoredValue reads the value stored for an asset key, without the pending
+// deltas of a counter, returning nil if the key does not exist or has expired
+func getStoredValue(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	value, err := stub.GetState(config.Namespace + key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	expiresAt, err := getExpiry(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	if !expiresAt.IsZero() {
+		now, err := getTxTime(stub)
+		if err != nil {
+			return nil, err
+		}
+		if !now.Before(expiresAt) {
+			logger.Info("Asset has expired : ", key)
+			return nil, nil
+		}
+	}
+	return readValue(stub, key, value)
+}
+
+// putAsset writes the value of an asset key and records the current txID as
+// its version. The caller becomes the owner of keys that have none yet. Any
+// expiry set by a previous write is cleared.
+func putAsset(stub shim.ChaincodeStubInterface, caller callerIdentity, key string, value string) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	err = putValue(stub, config, key, value)
+	if err != nil {
+		return err
+	}
+	err = clearExpiry(stub, key)
+	if err != nil {
+		return err
+	}
+	err = clearCounterDeltas(stub, key)
+	if err != nil {
+		return err
+	}
+	versionKey, err := recordKey(stub, versionIndex, key)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(versionKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return err
+	}
+	recordChange(stub, keyChange{Type: eventKeySet, Key: key, ValueHash: hashValue(value)})
+
+	owner, err := getKeyOwner(stub, key)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		return putOwner(stub, key, caller.keyOwner)
+	}
+	return nil
+}
+
+// deleteAsset removes an asset key together with its version, owner and
+// expiry records, so the next writer of the key becomes its owner
+func deleteAsset(stub shim.ChaincodeStubInterface, key string) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(config.Namespace + key)
+	if err != nil {
+		return err
+	}
+	err = clearChunks(stub, key)
+	if err != nil {
+		return err
+	}
+	err = clearExpiry(stub, key)
+	if err != nil {
+		return err
+	}
+	err = clearCounterDeltas(stub, key)
+	if err != nil {
+		return err
+	}
+	for _, index := range []string{versionIndex, ownerIndex} {
+		indexKey, err := recordKey(stub, index, key)
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(indexKey)
+		if err != nil {
+			return err
+		}
+	}
+	recordChange(stub, keyChange{Type: eventKeyDeleted, Key: key})
+	return nil
+}
+
+// putValue writes the state entry of an asset key. Values larger than the
+// chunk size are split across chunk entries and the state entry of the key
+// holds their manifest instead.
+func putValue(stub shim.ChaincodeStubInterface, config chaincodeConfig, key string, value string) error {
+	err := clearChunks(stub, key)
+	if err != nil {
+		return err
+	}
+	chunkSize := config.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+	if len(value) <= chunkSize {
+		return stub.PutState(config.Namespace+key, []byte(value))
+	}
+
+	manifest := chunkManifest{Size: len(value), SHA256: hashValue(value)}
+	for offset := 0; offset < len(value); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		chunkKey, err := recordKey(stub, chunkIndex, key, fmt.Sprintf("%06d", manifest.Chunks))
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(chunkKey, []byte(value[offset:end]))
+		if err != nil {
+			return err
+		}
+		manifest.Chunks++
+	}
+
+	manifestAsBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(config.Namespace+key, manifestAsBytes)
+	if err != nil {
+		return err
+	}
+	chunkedKey, err := recordKey(stub, chunkedIndex, key)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(chunkedKey, []byte{0x00})
+}
+
+// readValue returns the value of an asset key given the content of its state
+// entry, reassembling and verifying chunked values
+func readValue(stub shim.ChaincodeStubInterface, key string, stored []byte) ([]byte, error) {
+	manifest, err := getChunkManifest(stub, key, stored)
+	if err != nil || manifest == nil {
+		return stored, err
+	}
+
+	value := make([]byte, 0, manifest.Size)
+	for i := 0; i < manifest.Chunks; i++ {
+		chunkKey, err := recordKey(stub, chunkIndex, key, fmt.Sprintf("%06d", i))
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := stub.GetState(chunkKey)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, chunk...)
+	}
+	if len(value) != manifest.Size || hashValue(string(value)) != manifest.SHA256 {
+		return nil, fmt.Errorf("chunked value of key %s does not match its manifest", key)
+	}
+	return value, nil
+}
+
+// getChunkManifest returns the manifest of a chunked asset key given the
+// content of its state entry, or nil if the value is not chunked
+func getChunkManifest(stub shim.ChaincodeStubInterface, key string, stored []byte) (*chunkManifest, error) {
+	chunkedKey, err := recordKey(stub, chunkedIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	chunked, err := stub.GetState(chunkedKey)
+	if err != nil || chunked == nil {
+		return nil, err
+	}
+	var manifest chunkManifest
+	err = json.Unmarshal(stored, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// clearChunks removes the chunk entries and the chunked marker of an asset
+// key, if its current value is chunked
+func clearChunks(stub shim.ChaincodeStubInterface, key string) error {
+	chunkedKey, err := recordKey(stub, chunkedIndex, key)
+	if err != nil {
+		return err
+	}
+	chunked, err := stub.GetState(chunkedKey)
+	if err != nil || chunked == nil {
+		return err
+	}
+
+	resultsIterator, err := getRecords(stub, chunkIndex, key)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return stub.DelState(chunkedKey)
+}
+
+// putCounterDelta records a pending delta of a counter under its own key, so
+// that concurrent increments neither read nor write the same entries. The
+// caller becomes the owner of counters that have none yet.
+func putCounterDelta(stub shim.ChaincodeStubInterface, caller callerIdentity, key string, delta int64) error {
+	deltaKey, err := recordKey(stub, counterDeltaIndex, key, stub.GetTxID())
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(deltaKey, []byte(strconv.FormatInt(delta, 10)))
+	if err != nil {
+		return err
+	}
+	counterKey, err := recordKey(stub, counterIndex, key)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(counterKey, []byte("true"))
+	if err != nil {
+		return err
+	}
+	versionKey, err := recordKey(stub, versionIndex, key)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(versionKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return err
+	}
+	recordChange(stub, keyChange{Type: eventKeySet, Key: key})
+
+	owner, err := getKeyOwner(stub, key)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		return putOwner(stub, key, caller.keyOwner)
+	}
+	return nil
+}
+
+// addCounterDeltas adds the pending deltas of a counter to its stored value,
+// which counts as 0 when missing. Values of keys without pending deltas are
+// returned unchanged.
+func addCounterDeltas(stub shim.ChaincodeStubInterface, key string, value []byte) ([]byte, error) {
+	counterKey, err := recordKey(stub, counterIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	counter, err := stub.GetState(counterKey)
+	if err != nil || counter == nil {
+		return value, err
+	}
+
+	total := int64(0)
+	if value != nil {
+		total, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("value of counter %s is not an integer", key)
+		}
+	}
+	resultsIterator, err := getRecords(stub, counterDeltaIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		delta, err := strconv.ParseInt(string(queryResponse.Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		total, ok = addDelta(total, delta)
+		if !ok {
+			return nil, fmt.Errorf("deltas of counter %s overflow its value", key)
+		}
+	}
+	return []byte(strconv.FormatInt(total, 10)), nil
+}
+
+// clearCounterDeltas removes the pending deltas of a counter and its marker,
+// if it has any
+func clearCounterDeltas(stub shim.ChaincodeStubInterface, key string) error {
+	counterKey, err := recordKey(stub, counterIndex, key)
+	if err != nil {
+		return err
+	}
+	counter, err := stub.GetState(counterKey)
+	if err != nil || counter == nil {
+		return err
+	}
+
+	resultsIterator, err := getRecords(stub, counterDeltaIndex, key)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return stub.DelState(counterKey)
+}
+
+// recordChange adds a mutation to the event of the current transaction
+func recordChange(stub shim.ChaincodeStubInterface, change keyChange) {
+	if recorder, ok := stub.(*changeRecorder); ok {
+		recorder.changes = append(recorder.changes, change)
+	}
+}
+
+// emitChanges sets the chaincode event reporting the mutations of the
+// current transaction. The event is named after the configured prefix and
+// the type of the changes.
+func emitChanges(stub shim.ChaincodeStubInterface, changes []keyChange) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return err
+	}
+
+	eventType := changes[0].Type
+	for _, change := range changes {
+		if change.Type != eventType {
+			eventType = eventKeysChanged
+			break
+		}
+	}
+	eventAsBytes, err := json.Marshal(changeEvent{TxId: stub.GetTxID(), MSPID: mspID, Changes: changes})
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(config.EventNamePrefix+eventType, eventAsBytes)
+}
+
+// hashValue returns the hex encoded SHA-256 hash of a value
+func hashValue(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// getConfig reads the configuration stored by Init and fills in defaults
+func getConfig(stub shim.ChaincodeStubInterface) (chaincodeConfig, error) {
+	config := chaincodeConfig{AdminAttribute: defaultAdminAttribute}
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{})
+	if err != nil {
+		return config, err
+	}
+	configAsBytes, err := stub.GetState(configKey)
+	if err != nil || configAsBytes == nil {
+		return config, err
+	}
+	err = json.Unmarshal(configAsBytes, &config)
+	if config.AdminAttribute == "" {
+		config.AdminAttribute = defaultAdminAttribute
+	}
+	return config, err
+}
+
+// checkAllowedMSP rejects the transaction with status 403 if allowed MSPs are
+// configured and the caller belongs to none of them
+func checkAllowedMSP(stub shim.ChaincodeStubInterface) (peer.Response, bool) {
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to read configuration.", nil), false
+	}
+	if len(config.AllowedMSPs) == 0 {
+		return peer.Response{}, true
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		logger.Error("Error occured while reading caller MSP id: ", err)
+		return errorResponse(shim.ERROR, errCodeInternal, "Failed to get caller identity.", nil), false
+	}
+	for _, allowed := range config.AllowedMSPs {
+		if mspID == allowed {
+			return peer.Response{}, true
+		}
+	}
+	logger.Info("Access denied for MSP : ", mspID)
+	return errorResponse(403, errCodeForbidden, "Organization "+mspID+" is not allowed to invoke this smart contract.", nil), false
+}
+
+// checkValueSize rejects values larger than the configured maximum size
+func checkValueSize(config chaincodeConfig, key string, value string) (peer.Response, bool) {
+	if config.MaxValueSize > 0 && len(value) > config.MaxValueSize {
+		return errorResponse(400, errCodeValueTooLarge, "Value of key "+key+" exceeds the maximum size of "+strconv.Itoa(config.MaxValueSize)+" bytes: "+strconv.Itoa(len(value))+" given.", map[string]interface{}{"key": key, "maxValueSize": config.MaxValueSize, "size": len(value)}), false
+	}
+	return peer.Response{}, true
+}
+
+// putConfig stores the configuration under its reserved key
+func putConfig(stub shim.ChaincodeStubInterface, config chaincodeConfig) error {
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{})
+	if err != nil {
+		return err
+	}
+	configAsBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(configKey, configAsBytes)
+}
+
+// getCaller reads the identity submitting the transaction from its creator
+// certificate
+func getCaller(stub shim.ChaincodeStubInterface) (callerIdentity, error) {
+	identity, err := cid.New(stub)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	id, err := identity.GetID()
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	admin, found, err := identity.GetAttributeValue(config.AdminAttribute)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	return callerIdentity{keyOwner: keyOwner{ID: id, MSPID: mspID}, Admin: found && admin == "true"}, nil
+}
+
+// checkWriteAccess rejects the transaction with status 403 unless the caller
+// owns the asset key, the key has no owner yet or the caller is an admin
+func checkWriteAccess(stub shim.ChaincodeStubInterface, caller callerIdentity, key string) (peer.Response, bool) {
+	if caller.Admin {
+		return peer.Response{}, true
+	}
+	owner, err := getKeyOwner(stub, key)
+	if err != nil {
+		logger.Error("Error occured while reading owner: ", err)
+		return errorResponse(shim.ERROR, errCodeLedger, "Failed to get owner of asset: "+key, nil), false
+	}
+	return checkOwner(caller, owner, key)
+}
+
+// checkOwner rejects the transaction with status 403 unless the key has no
+// owner yet, the caller is its owner or the caller is an admin
+func checkOwner(caller callerIdentity, owner *keyOwner, key string) (peer.Response, bool) {
+	if !caller.Admin && owner != nil && *owner != caller.keyOwner {
+		logger.Info("Write access denied for key : ", key)
+		return errorResponse(403, errCodeForbidden, "Caller is not the owner of asset: "+key, nil), false
+	}
+	return peer.Response{}, true
+}
+
+// getKeyOwner returns the owner recorded for an asset key, or nil if the key
+// has no owner
+func getKeyOwner(stub shim.ChaincodeStubInterface, key string) (*keyOwner, error) {
+	ownerKey, err := recordKey(stub, ownerIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	ownerAsBytes, err := stub.GetState(ownerKey)
+	if err != nil || ownerAsBytes == nil {
+		return nil, err
+	}
+	var owner keyOwner
+	err = json.Unmarshal(ownerAsBytes, &owner)
+	if err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+// putOwner records the owner of an asset key
+func putOwner(stub shim.ChaincodeStubInterface, key string, owner keyOwner) error {
+	ownerKey, err := recordKey(stub, ownerIndex, key)
+	if err != nil {
+		return err
+	}
+	ownerAsBytes, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(ownerKey, ownerAsBytes)
+}
+
+// recordKey builds the composite key of a record kept by an index for an
+// asset key, followed by the given attributes. The asset key is namespaced
+// like its state entry.
+func recordKey(stub shim.ChaincodeStubInterface, index string, key string, attributes ...string) (string, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	return stub.CreateCompositeKey(index, append([]string{config.Namespace + key}, attributes...))
+}
+
+// getRecords returns an iterator over the records kept by an index for an
+// asset key
+func getRecords(stub shim.ChaincodeStubInterface, index string, key string) (shim.StateQueryIteratorInterface, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	return stub.GetStateByPartialCompositeKey(index, []string{config.Namespace + key})
+}
+
+// getPrivateKeyOwner returns the owner recorded in a private data collection
+// for one of its keys, or nil if the key has no owner
+func getPrivateKeyOwner(stub shim.ChaincodeStubInterface, collection string, key string) (*keyOwner, error) {
+	ownerKey, err := recordKey(stub, ownerIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	ownerAsBytes, err := stub.GetPrivateData(collection, ownerKey)
+	if err != nil || ownerAsBytes == nil {
+		return nil, err
+	}
+	var owner keyOwner
+	err = json.Unmarshal(ownerAsBytes, &owner)
+	if err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+// putPrivateKeyOwner records the owner of a key in a private data collection,
+// so that the identity of the owner is only shared with its members
+func putPrivateKeyOwner(stub shim.ChaincodeStubInterface, collection string, key string, owner keyOwner) error {
+	ownerKey, err := recordKey(stub, ownerIndex, key)
+	if err != nil {
+		return err
+	}
+	ownerAsBytes, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	return stub.PutPrivateData(collection, ownerKey, ownerAsBytes)
+}
+
+// getAssetVersion returns the txID of the last write to an asset key, or
+// unrecordedVersion if no version was recorded
+func getAssetVersion(stub shim.ChaincodeStubInterface, key string) (string, error) {
+	versionKey, err := recordKey(stub, versionIndex, key)
+	if err != nil {
+		return "", err
+	}
+	version, err := stub.GetState(versionKey)
+	if err != nil {
+		return "", err
+	}
+	if version == nil {
+		return unrecordedVersion, nil
+	}
+	return string(version), nil
+}
+
+// getDataVersion returns the version of the stored data layout, zero for
+// data written before versions were recorded
+func getDataVersion(stub shim.ChaincodeStubInterface) (int, error) {
+	versionKey, err := stub.CreateCompositeKey(dataVersionIndex, []string{})
+	if err != nil {
+		return 0, err
+	}
+	versionAsBytes, err := stub.GetState(versionKey)
+	if err != nil || versionAsBytes == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(versionAsBytes))
+}
+
+// putDataVersion stores the version of the stored data layout
+func putDataVersion(stub shim.ChaincodeStubInterface, version int) error {
+	versionKey, err := stub.CreateCompositeKey(dataVersionIndex, []string{})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(versionKey, []byte(strconv.Itoa(version)))
+}
+
+// migrateToVersion1 records a version for the keys written by get-set 1.0.0,
+// which did not track versions. The txID of the upgrade is used as version.
+// Only the keys of the configured namespace are migrated.
+func migrateToVersion1(stub shim.ChaincodeStubInterface) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	startKey, endKey := "", ""
+	if config.Namespace != "" {
+		startKey, endKey = config.Namespace, config.Namespace+string(utf8.MaxRune)
+	}
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		key := strings.TrimPrefix(queryResponse.Key, config.Namespace)
+		version, err := getAssetVersion(stub, key)
+		if err != nil {
+			return err
+		}
+		if version != unrecordedVersion {
+			continue
+		}
+		versionKey, err := recordKey(stub, versionIndex, key)
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(versionKey, []byte(stub.GetTxID()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getKeyHistory returns the modifications of an asset key in ledger order.
+// The history of the key only holds the manifest of chunked values and misses
+// the increments of counters in delta mode, so the histories of the chunk,
+// counter and expiry records written by the same transactions are read as
+// well to report the value in effect after each modification.
+func getKeyHistory(stub shim.ChaincodeStubInterface, key string) ([]historyEntry, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	chunkedKey, err := recordKey(stub, chunkedIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	chunked, err := getRecordHistory(stub, chunkedKey)
+	if err != nil {
+		return nil, err
+	}
+	expiryKey, err := recordKey(stub, expiryIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	expiries, err := getRecordHistory(stub, expiryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(config.Namespace + key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	history := []historyEntry{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		entry := historyEntry{
+			TxId:      modification.TxId,
+			Timestamp: historyTime(modification).Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+		}
+		if !modification.IsDelete {
+			value := modification.Value
+			if _, found := chunked[modification.TxId]; found {
+				value, err = getHistoryChunks(stub, key, modification.TxId, value)
+				if err != nil {
+					return nil, err
+				}
+			}
+			stored := string(value)
+			entry.Value = &stored
+			entry.ExpiresAt = string(expiries[modification.TxId])
+		}
+		history = append(history, entry)
+	}
+	return addHistoryDeltas(stub, key, history)
+}
+
+// addHistoryDeltas merges the increments of a counter in delta mode into the
+// history of its asset key, in timestamp order. Each of them wrote the counter
+// marker and its own delta entry, and is reported with the value of the
+// counter it resulted in.
+func addHistoryDeltas(stub shim.ChaincodeStubInterface, key string, history []historyEntry) ([]historyEntry, error) {
+	counterKey, err := recordKey(stub, counterIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetHistoryForKey(counterKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	deltas := []historyEntry{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if modification.IsDelete {
+			continue
+		}
+		deltaKey, err := recordKey(stub, counterDeltaIndex, key, modification.TxId)
+		if err != nil {
+			return nil, err
+		}
+		written, err := getRecordHistory(stub, deltaKey)
+		if err != nil {
+			return nil, err
+		}
+		delta, err := strconv.ParseInt(string(written[modification.TxId]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("delta of counter %s written by %s is not an integer", key, modification.TxId)
+		}
+		deltas = append(deltas, historyEntry{TxId: modification.TxId, Timestamp: historyTime(modification).Format(time.RFC3339Nano), Delta: &delta})
+	}
+	if len(deltas) == 0 {
+		return history, nil
+	}
+
+	merged := make([]historyEntry, 0, len(history)+len(deltas))
+	var current *historyEntry
+	for len(history) > 0 || len(deltas) > 0 {
+		if len(deltas) == 0 || (len(history) > 0 && !entryTime(history[0]).After(entryTime(deltas[0]))) {
+			merged = append(merged, history[0])
+			history = history[1:]
+		} else {
+			entry := deltas[0]
+			deltas = deltas[1:]
+			// a missing, deleted or expired value counts as 0
+			total := int64(0)
+			if current != nil && current.Value != nil && !historyExpired(*current, entryTime(entry)) {
+				total, err = strconv.ParseInt(*current.Value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("value of counter %s is not an integer", key)
+				}
+				entry.ExpiresAt = current.ExpiresAt
+			}
+			total, ok := addDelta(total, *entry.Delta)
+			if !ok {
+				return nil, fmt.Errorf("deltas of counter %s overflow its value", key)
+			}
+			value := strconv.FormatInt(total, 10)
+			entry.Value = &value
+			merged = append(merged, entry)
+		}
+		current = &merged[len(merged)-1]
+	}
+	return merged, nil
+}
+
+// getRecordHistory returns the values written to a record, keyed by the txID
+// of the writing transaction. Deletes are left out.
+func getRecordHistory(stub shim.ChaincodeStubInterface, indexKey string) (map[string][]byte, error) {
+	resultsIterator, err := stub.GetHistoryForKey(indexKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	values := make(map[string][]byte)
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !modification.IsDelete {
+			values[modification.TxId] = modification.Value
+		}
+	}
+	return values, nil
+}
+
+// getHistoryChunks reassembles a chunked value written by a past transaction
+// from the chunk entries that transaction wrote, and verifies it against its
+// manifest
+func getHistoryChunks(stub shim.ChaincodeStubInterface, key string, txID string, stored []byte) ([]byte, error) {
+	var manifest chunkManifest
+	err := json.Unmarshal(stored, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, 0, manifest.Size)
+	for i := 0; i < manifest.Chunks; i++ {
+		chunkKey, err := recordKey(stub, chunkIndex, key, fmt.Sprintf("%06d", i))
+		if err != nil {
+			return nil, err
+		}
+		written, err := getRecordHistory(stub, chunkKey)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, written[txID]...)
+	}
+	if len(value) != manifest.Size || hashValue(string(value)) != manifest.SHA256 {
+		return nil, fmt.Errorf("chunked value of key %s written by %s does not match its manifest", key, txID)
+	}
+	return value, nil
+}
+
+// historyTime returns the timestamp of the transaction of a key modification
+func historyTime(modification *queryresult.KeyModification) time.Time {
+	return time.Unix(modification.Timestamp.GetSeconds(), int64(modification.Timestamp.GetNanos())).UTC()
+}
+
+// entryTime returns the timestamp of a history entry
+func entryTime(entry historyEntry) time.Time {
+	timestamp, _ := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	return timestamp
+}
+
+// historyExpired reports whether the value of a history entry had expired at
+// the given time
+func historyExpired(entry historyEntry, at time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339Nano, entry.ExpiresAt)
+	return err == nil && !at.Before(expiresAt)
+}
+
+// getTxTime returns the timestamp of the current transaction, which is the
+// same on every endorsing peer
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC(), nil
+}
+
+// parseExpiry converts a TTL (a duration such as "90s" or "24h", or a number
+// of seconds) or an absolute RFC 3339 time into an expiry time after now
+func parseExpiry(expiry string, now time.Time) (time.Time, error) {
+	var expiresAt time.Time
+	if ttl, err := time.ParseDuration(expiry); err == nil {
+		expiresAt = now.Add(ttl)
+	} else if seconds, err := strconv.ParseInt(expiry, 10, 64); err == nil {
+		expiresAt = now.Add(time.Duration(seconds) * time.Second)
+	} else if expiresAt, err = time.Parse(time.RFC3339Nano, expiry); err != nil {
+		return time.Time{}, fmt.Errorf("Expiry must be a TTL such as \"3600s\" or an RFC 3339 time: %s given.", expiry)
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, fmt.Errorf("Expiry must be in the future: %s given.", expiry)
+	}
+	return expiresAt.UTC(), nil
+}
+
+// getExpiry returns the expiry time of an asset key, or the zero time if the
+// key does not expire
+func getExpiry(stub shim.ChaincodeStubInterface, key string) (time.Time, error) {
+	expiryKey, err := recordKey(stub, expiryIndex, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiryAsBytes, err := stub.GetState(expiryKey)
+	if err != nil || expiryAsBytes == nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, string(expiryAsBytes))
+}
+
+// isExpired reports whether an asset key has an expiry time that has passed.
+// Expired keys keep their records until purgeExpired deletes them.
+func isExpired(stub shim.ChaincodeStubInterface, key string) (bool, error) {
+	expiresAt, err := getExpiry(stub, key)
+	if err != nil || expiresAt.IsZero() {
+		return false, err
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(expiresAt), nil
+}
+
+// putExpiry records the expiry time of an asset key and indexes it by time
+func putExpiry(stub shim.ChaincodeStubInterface, key string, expiresAt time.Time) error {
+	expiryKey, err := recordKey(stub, expiryIndex, key)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(expiryKey, []byte(expiresAt.Format(time.RFC3339Nano)))
+	if err != nil {
+		return err
+	}
+	orderKey, err := expiryOrderKey(stub, key, expiresAt)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(orderKey, []byte{0x00})
+}
+
+// clearExpiry removes the expiry record of an asset key and its index entry
+func clearExpiry(stub shim.ChaincodeStubInterface, key string) error {
+	expiresAt, err := getExpiry(stub, key)
+	if err != nil || expiresAt.IsZero() {
+		return err
+	}
+	expiryKey, err := recordKey(stub, expiryIndex, key)
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(expiryKey)
+	if err != nil {
+		return err
+	}
+	orderKey, err := expiryOrderKey(stub, key, expiresAt)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(orderKey)
+}
+
+// expiryOrderKey builds the expiry index key of an asset key. Entries are
+// grouped by namespace and the expiry time is zero padded, so that the index
+// keys of a namespace sort in time order.
+func expiryOrderKey(stub shim.ChaincodeStubInterface, key string, expiresAt time.Time) (string, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	return stub.CreateCompositeKey(expiryOrderIndex, []string{config.Namespace, fmt.Sprintf("%019d", expiresAt.UnixNano()), key})
+}
+
+// loadSchemas reads every schema registered through registerSchema in the
+// configured namespace
+func loadSchemas(stub shim.ChaincodeStubInterface) ([]schemaDefinition, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(schemaIndex, []string{config.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	schemas := []schemaDefinition{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var definition schemaDefinition
+		if err := json.Unmarshal(queryResponse.Value, &definition); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, definition)
+	}
+	return schemas, nil
+}
+
+// matchSchema returns the schema registered for the longest prefix of a key,
+// or nil if no schema applies to it
+func matchSchema(schemas []schemaDefinition, key string) *schemaDefinition {
+	var match *schemaDefinition
+	for i := range schemas {
+		if strings.HasPrefix(key, schemas[i].Prefix) && (match == nil || len(schemas[i].Prefix) > len(match.Prefix)) {
+			match = &schemas[i]
+		}
+	}
+	return match
+}
+
+// checkSchema validates a value against the schema registered for the longest
+// prefix of its key. Keys without a matching schema accept any value.
+func checkSchema(schemas []schemaDefinition, key string, value string) (peer.Response, bool) {
+	match := matchSchema(schemas, key)
+	if match == nil {
+		return peer.Response{}, true
+	}
+
+	failures := []string{}
+	switch match.Type {
+	case schemaTypeString:
+	case schemaTypeNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			failures = append(failures, "$: expected number")
+		}
+	case schemaTypeJSON:
+		if !json.Valid([]byte(value)) {
+			failures = append(failures, "$: expected JSON")
+		}
+	case schemaTypeJSONSchema:
+		var schema map[string]interface{}
+		var document interface{}
+		if err := json.Unmarshal(match.Schema, &schema); err != nil {
+			logger.Error("Error occured while parsing schema for prefix ", match.Prefix, ": ", err)
+			failures = append(failures, "$: invalid schema registered for prefix "+match.Prefix)
+		} else if err := json.Unmarshal([]byte(value), &document); err != nil {
+			failures = append(failures, "$: expected JSON")
+		} else {
+			validateJSONSchema(schema, document, "$", &failures)
+		}
+	}
+	if len(failures) > 0 {
+		logger.Info("Schema validation failed for key : ", key)
+		return errorResponse(400, errCodeSchemaViolation, "Value of key "+key+" does not match the schema registered for prefix \""+match.Prefix+"\": "+strings.Join(failures, "; "), map[string]interface{}{"key": key, "prefix": match.Prefix, "failures": failures}), false
+	}
+	return peer.Response{}, true
+}
+
+// validateJSONSchema checks a decoded JSON document against a subset of JSON
+// Schema (type, enum, required, properties, additionalProperties, items,
+// minimum, maximum, minLength, maxLength, pattern, minItems and maxItems) and
+// appends a "path: reason" entry to failures for every violation.
+func validateJSONSchema(schema map[string]interface{}, document interface{}, path string, failures *[]string) {
+	if types, ok := schemaTypes(schema["type"]); ok && !matchesJSONType(document, types) {
+		*failures = append(*failures, path+": expected "+strings.Join(types, " or "))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, document) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*failures = append(*failures, path+": value is not one of the allowed values")
+		}
+	}
+
+	switch value := document.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, field := range required {
+				if name, ok := field.(string); ok {
+					if _, present := value[name]; !present {
+						*failures = append(*failures, path+"."+name+": required")
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+				validateJSONSchema(propertySchema, value[name], path+"."+name, failures)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*failures = append(*failures, path+"."+name+": additional property not allowed")
+			}
+		}
+	case []interface{}:
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(value)) < minItems {
+			*failures = append(*failures, path+": expected at least "+strconv.FormatFloat(minItems, 'f', -1, 64)+" items")
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(value)) > maxItems {
+			*failures = append(*failures, path+": expected at most "+strconv.FormatFloat(maxItems, 'f', -1, 64)+" items")
+		}
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				validateJSONSchema(itemSchema, item, path+"["+strconv.Itoa(i)+"]", failures)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+			*failures = append(*failures, path+": expected at least "+strconv.FormatFloat(minLength, 'f', -1, 64)+" characters")
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+			*failures = append(*failures, path+": expected at most "+strconv.FormatFloat(maxLength, 'f', -1, 64)+" characters")
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil || !re.MatchString(value) {
+				*failures = append(*failures, path+": does not match pattern "+pattern)
+			}
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && value < minimum {
+			*failures = append(*failures, path+": expected a value of at least "+strconv.FormatFloat(minimum, 'f', -1, 64))
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && value > maximum {
+			*failures = append(*failures, path+": expected a value of at most "+strconv.FormatFloat(maximum, 'f', -1, 64))
+		}
+	}
+}
+
+// schemaTypes returns the JSON Schema "type" keyword as a list of type names
+func schemaTypes(keyword interface{}) ([]string, bool) {
+	switch typed := keyword.(type) {
+	case string:
+		return []string{typed}, true
+	case []interface{}:
+		types := []string{}
+		for _, name := range typed {
+			if s, ok := name.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+// matchesJSONType reports whether a decoded JSON value is of one of the given
+// JSON Schema types
+func matchesJSONType(document interface{}, types []string) bool {
+	for _, name := range types {
+		switch value := document.(type) {
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && value == float64(int64(value))) {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case nil:
+			if name == "null" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // main function starts up the chaincode in the container during instantiate
@@ -0,0 +1,2079 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// attributesOID is the certificate extension holding the attributes read by
+// the client identity library
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// newIdentity returns a serialized identity of an MSP holding a self-signed
+// certificate for the given common name and attributes
+func newIdentity(mspID string, name string, attrs map[string]string) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if len(attrs) > 0 {
+		attrsAsBytes, _ := json.Marshal(map[string]map[string]string{"attrs": attrs})
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attrsAsBytes}}
+	}
+	certAsBytes, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	certAsPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes})
+	creator, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: certAsPEM})
+	return creator
+}
+
+// newMockStub returns a mockstub whose transactions are submitted by a
+// regular identity of Org1MSP
+func newMockStub() *shim.MockStub {
+	mockStub := shim.NewMockStub("mockstub", new(SimpleAsset))
+	mockStub.Creator = newIdentity("Org1MSP", "user1", nil)
+	return mockStub
+}
+
+// historyStub serves fixed key histories, as GetHistoryForKey is not
+// implemented in mockstub
+type historyStub struct {
+	*shim.MockStub
+	histories map[string][]*queryresult.KeyModification
+}
+
+func newHistoryStub() *historyStub {
+	return &historyStub{MockStub: newMockStub(), histories: map[string][]*queryresult.KeyModification{}}
+}
+
+func (stub *historyStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{history: stub.histories[key]}, nil
+}
+
+// historyIterator iterates over the history of a key of a historyStub
+type historyIterator struct {
+	history []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.history) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	next := it.history[0]
+	it.history = it.history[1:]
+	return next, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+// privateHashStub serves the hashes of the private data stored in the
+// mockstub, as GetPrivateDataHash is not implemented in mockstub
+type privateHashStub struct {
+	*shim.MockStub
+}
+
+func (stub *privateHashStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value := stub.PvtState[collection][key]
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// pageStub serves range queries with pagination from the mockstub, as
+// GetStateByRangeWithPagination is not implemented in mockstub. Its metadata
+// counts every record read, like the peer.
+type pageStub struct {
+	*shim.MockStub
+}
+
+func (stub *pageStub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	iterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	records := &pageIterator{}
+	for iterator.HasNext() && int32(len(records.kvs)) < pageSize {
+		kv, _ := iterator.Next()
+		records.kvs = append(records.kvs, kv)
+	}
+	return records, &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(records.kvs))}, nil
+}
+
+// pageIterator iterates over the records of a page served by a pageStub
+type pageIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *pageIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *pageIterator) Next() (*queryresult.KV, error) {
+	next := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return next, nil
+}
+
+func (it *pageIterator) Close() error {
+	return nil
+}
+
+func Test_Init(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.Init(mockStub)
+	mockStub.MockTransactionEnd(txId)
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("Init test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Invoke_noFunction(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+	args := []string{"noFunction", "key1", "value1"}
+	argsAsBytes := make([][]byte, len(args))
+	for i, v := range args {
+		argsAsBytes[i] = []byte(v)
+	}
+	response := mockStub.MockInvoke(txId, argsAsBytes)
+	if s := response.GetStatus(); s != 404 {
+		fmt.Println("Invoke_noFunction test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Main(t *testing.T) {
+	main()
+}
+
+func Test_set(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	args := []string{"key1", "value1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.set(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 || string(mockStub.State["key1"]) != "value1" {
+		fmt.Println("set test failed")
+		t.FailNow()
+	}
+}
+
+func Test_get(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.get(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 || string(response.GetPayload()) != "value1" {
+		fmt.Println("get test failed")
+		t.FailNow()
+	}
+}
+
+func Test_get_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.get(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("get_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setMany(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	args := []string{`[{"key": "key1", "value": "value1"}, {"key": "key2", "value": "value2"}]`}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.setMany(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var results map[string]batchResult
+	if err := json.Unmarshal(response.GetPayload(), &results); err != nil || response.GetStatus() != 200 || len(results) != 2 || results["key2"].Value != "value2" {
+		fmt.Println("setMany test failed")
+		t.FailNow()
+	}
+	if string(mockStub.State["key1"]) != "value1" || string(mockStub.State["key2"]) != "value2" {
+		fmt.Println("setMany test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setMany_invalidJSON(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	args := []string{`{"key": "key1", "value": "value1"}`}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.setMany(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("setMany_invalidJSON test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setMany_emptyKey(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	args := []string{`[{"key": "key1", "value": "value1"}, {"key": "", "value": "value2"}]`}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.setMany(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// the batch is all or nothing
+	if s := response.GetStatus(); s != 400 || mockStub.State["key1"] != nil {
+		fmt.Println("setMany_emptyKey test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setMany_duplicateKey(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	args := []string{`[{"key": "key1", "value": "value1", "expiry": "1h"}, {"key": "key1", "value": "value2"}]`}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.setMany(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 || parseError(response).Code != errCodeInvalidArgument || mockStub.State["key1"] != nil {
+		fmt.Println("setMany_duplicateKey test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setMany_emptyBatch(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.setMany(mockStub, []string{"[]"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("setMany_emptyBatch test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getMany(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.getMany(mockStub, []string{`["key1", "key2"]`})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var results map[string]batchResult
+	if err := json.Unmarshal(response.GetPayload(), &results); err != nil || response.GetStatus() != 200 {
+		fmt.Println("getMany test failed")
+		t.FailNow()
+	}
+	if results["key1"].Status != 200 || results["key1"].Value != "value1" || results["key2"].Status != 400 || results["key2"].Code != errCodeNotFound {
+		fmt.Println("getMany test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getMany_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getMany(mockStub, []string{`["key1"]`, `["key2"]`})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getMany_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_delete(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.delete(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 || mockStub.State["key1"] != nil {
+		fmt.Println("delete test failed")
+		t.FailNow()
+	}
+}
+
+func Test_delete_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.delete(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("delete_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_delete_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.delete(mockStub, []string{"key1", "key2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("delete_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistory(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	mockStub.histories["key1"] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: []byte("value1"), Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+		{TxId: "tx2", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546300900}},
+	}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistory(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var history []historyEntry
+	if err := json.Unmarshal(response.GetPayload(), &history); err != nil || response.GetStatus() != 200 || len(history) != 2 {
+		fmt.Println("getHistory test failed")
+		t.FailNow()
+	}
+	if history[0].TxId != "tx1" || *history[0].Value != "value1" || history[0].Timestamp != "2019-01-01T00:00:00Z" || !history[1].IsDelete || history[1].Value != nil {
+		fmt.Println("getHistory test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistory_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistory(mockStub, []string{})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getHistory_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compareAndSet(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.compareAndSet(mockStub, []string{"key1", "value1", "value2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 || string(mockStub.State["key1"]) != "value2" {
+		fmt.Println("compareAndSet test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compareAndSet_mismatch(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.compareAndSet(mockStub, []string{"key1", "value3", "value2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 409 || string(mockStub.State["key1"]) != "value1" {
+		fmt.Println("compareAndSet_mismatch test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compareAndSet_version(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+
+	mockStub.MockTransactionStart("tx1")
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	mockStub.MockTransactionEnd("tx1")
+
+	mockStub.MockTransactionStart("tx2")
+	response := simpleCC.compareAndSet(mockStub, []string{"key1", "tx1", "value2", "version"})
+	mockStub.MockTransactionEnd("tx2")
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 || string(mockStub.State["key1"]) != "value2" {
+		fmt.Println("compareAndSet_version test failed")
+		t.FailNow()
+	}
+
+	// the version is now tx2
+	mockStub.MockTransactionStart("tx3")
+	response = simpleCC.compareAndSet(mockStub, []string{"key1", "tx1", "value3", "version"})
+	mockStub.MockTransactionEnd("tx3")
+	if s := response.GetStatus(); s != 409 {
+		fmt.Println("compareAndSet_version test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compareAndSet_unrecordedVersion(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	// value written before versions were recorded
+	mockStub.State["key1"] = []byte("value1")
+	txId := "mockTxID"
+
+	for _, c := range []struct {
+		expected string
+		status   int32
+	}{
+		{"", 409},
+		{"0", 200},
+	} {
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.compareAndSet(mockStub, []string{"key1", c.expected, "value2", "version"})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != c.status {
+			fmt.Println("compareAndSet_unrecordedVersion test failed")
+			t.FailNow()
+		}
+	}
+}
+
+func Test_compareAndSet_keepsExpiry(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1", "1h"})
+	before, _ := getExpiry(mockStub, "key1")
+	response := simpleCC.compareAndSet(mockStub, []string{"key1", "value1", "value2"})
+	after, _ := getExpiry(mockStub, "key1")
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 || before.IsZero() || !after.Equal(before) {
+		fmt.Println("compareAndSet_keepsExpiry test failed")
+		t.FailNow()
+	}
+	orderKey, _ := expiryOrderKey(mockStub, "key1", after)
+	if mockStub.State[orderKey] == nil {
+		fmt.Println("compareAndSet_keepsExpiry test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compareAndSet_invalidMode(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.compareAndSet(mockStub, []string{"key1", "value1", "value2", "other"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("compareAndSet_invalidMode test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compareAndSet_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.compareAndSet(mockStub, []string{"key1", "value1", "value2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("compareAndSet_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getWithVersion(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response := simpleCC.getWithVersion(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var result versionedValue
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || response.GetStatus() != 200 || result.Value != "value1" || result.Version != txId {
+		fmt.Println("getWithVersion test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getWithVersion_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getWithVersion(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getWithVersion_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_listKeys(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.setMany(mockStub, []string{`[{"key": "key1", "value": "value1"}, {"key": "key2", "value": "value2"}, {"key": "other1", "value": "value3"}]`})
+	response := simpleCC.listKeys(mockStub, []string{"key"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var result keyListResult
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || response.GetStatus() != 200 {
+		fmt.Println("listKeys test failed")
+		t.FailNow()
+	}
+	if len(result.Keys) != 2 || result.Keys[0] != "key1" || result.Keys[1] != "key2" || result.FetchedRecordsCount != 2 {
+		fmt.Println("listKeys test failed")
+		t.FailNow()
+	}
+}
+
+func Test_listKeys_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.listKeys(mockStub, []string{"key", "10", "", "key2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("listKeys_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getRange(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.setMany(mockStub, []string{`[{"key": "key1", "value": "value1"}, {"key": "key2", "value": "value2"}, {"key": "key3", "value": "value3"}]`})
+	response := simpleCC.getRange(mockStub, []string{"key1", "key3"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var result rangeResult
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || response.GetStatus() != 200 {
+		fmt.Println("getRange test failed")
+		t.FailNow()
+	}
+	if len(result.Records) != 2 || result.Records[0].Value != "value1" || result.Records[1].Key != "key2" {
+		fmt.Println("getRange test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getRange_expiredPage(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := &pageStub{MockStub: newMockStub()}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.setMany(mockStub, []string{`[{"key": "key1", "value": "value1"}, {"key": "key2", "value": "value2", "expiry": "60"}]`})
+	mockStub.TxTimestamp.Seconds += 61
+	response := simpleCC.getRange(mockStub, []string{"key1", "", "10"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// the expired key is not counted
+	var result rangeResult
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || len(result.Records) != 1 || result.FetchedRecordsCount != 1 {
+		fmt.Println("getRange_expiredPage test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getRange_invalidPageSize(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getRange(mockStub, []string{"key1", "key3", "1001"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getRange_invalidPageSize test failed")
+		t.FailNow()
+	}
+}
+
+func Test_registerSchema(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	mockStub.Creator = newIdentity("Org1MSP", "admin1", map[string]string{"getset.admin": "true"})
+	txId := "mockTxID"
+
+	schema := `{"type": "object", "required": ["name"], "properties": {"age": {"type": "integer", "minimum": 0}}}`
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.registerSchema(mockStub, []string{"person/", schema})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("registerSchema test failed")
+		t.FailNow()
+	}
+
+	response = simpleCC.set(mockStub, []string{"person/1", `{"name": "Alice", "age": 30}`})
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("registerSchema test failed")
+		t.FailNow()
+	}
+	response = simpleCC.set(mockStub, []string{"person/2", `{"age": -1}`})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeSchemaViolation {
+		fmt.Println("registerSchema test failed")
+		t.FailNow()
+	}
+}
+
+func Test_registerSchema_longestPrefix(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	mockStub.Creator = newIdentity("Org1MSP", "admin1", map[string]string{"getset.admin": "true"})
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.registerSchema(mockStub, []string{"count", "json"})
+	simpleCC.registerSchema(mockStub, []string{"counter/", "number"})
+	response := simpleCC.set(mockStub, []string{"counter/1", "abc"})
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("registerSchema_longestPrefix test failed")
+		t.FailNow()
+	}
+	response = simpleCC.set(mockStub, []string{"counter/1", "12.5"})
+	mockStub.MockTransactionEnd(txId)
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("registerSchema_longestPrefix test failed")
+		t.FailNow()
+	}
+}
+
+func Test_registerSchema_invalidSchema(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	mockStub.Creator = newIdentity("Org1MSP", "admin1", map[string]string{"getset.admin": "true"})
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.registerSchema(mockStub, []string{"person/", "integer"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("registerSchema_invalidSchema test failed")
+		t.FailNow()
+	}
+}
+
+func Test_registerSchema_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.registerSchema(mockStub, []string{"person/"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("registerSchema_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_registerSchema_adminAttribute(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+	mockStub.MockInit(txId, toArgs("init", `{"adminAttribute": "app1.admin"}`))
+
+	// only the configured attribute marks admins
+	for _, c := range []struct {
+		attrs  map[string]string
+		status int32
+	}{
+		{map[string]string{"getset.admin": "true"}, 403},
+		{map[string]string{"app1.admin": "true"}, 200},
+	} {
+		mockStub.Creator = newIdentity("Org1MSP", "admin1", c.attrs)
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.registerSchema(mockStub, []string{"person/", "json"})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != c.status {
+			fmt.Println("registerSchema_adminAttribute test failed")
+			t.FailNow()
+		}
+	}
+}
+
+func Test_registerSchema_forbidden(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.registerSchema(mockStub, []string{"person/", "json"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 403 || body.Code != errCodeForbidden {
+		fmt.Println("registerSchema_forbidden test failed")
+		t.FailNow()
+	}
+}
+
+func Test_set_notOwner(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	mockStub.Creator = newIdentity("Org2MSP", "user2", nil)
+	response := simpleCC.set(mockStub, []string{"key1", "value2"})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 403 || body.Code != errCodeForbidden {
+		fmt.Println("set_notOwner test failed")
+		t.FailNow()
+	}
+	response = simpleCC.delete(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	if s := response.GetStatus(); s != 403 {
+		fmt.Println("set_notOwner test failed")
+		t.FailNow()
+	}
+}
+
+func Test_set_admin(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	mockStub.Creator = newIdentity("Org2MSP", "admin2", map[string]string{"getset.admin": "true"})
+	response := simpleCC.set(mockStub, []string{"key1", "value2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("set_admin test failed")
+		t.FailNow()
+	}
+}
+
+func Test_transferKeyOwnership(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+	user1 := mockStub.Creator
+	user2 := newIdentity("Org2MSP", "user2", nil)
+
+	mockStub.MockTransactionStart(txId)
+	mockStub.Creator = user2
+	simpleCC.set(mockStub, []string{"key2", "value2"})
+	response := simpleCC.getOwner(mockStub, []string{"key2"})
+	var owner keyOwner
+	if err := json.Unmarshal(response.GetPayload(), &owner); err != nil || owner.MSPID != "Org2MSP" {
+		fmt.Println("transferKeyOwnership test failed")
+		t.FailNow()
+	}
+
+	mockStub.Creator = user1
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	response = simpleCC.transferKeyOwnership(mockStub, []string{"key1", owner.ID, owner.MSPID})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("transferKeyOwnership test failed")
+		t.FailNow()
+	}
+	response = simpleCC.set(mockStub, []string{"key1", "value3"})
+	if s := response.GetStatus(); s != 403 {
+		fmt.Println("transferKeyOwnership test failed")
+		t.FailNow()
+	}
+	mockStub.Creator = user2
+	response = simpleCC.set(mockStub, []string{"key1", "value3"})
+	mockStub.MockTransactionEnd(txId)
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("transferKeyOwnership test failed")
+		t.FailNow()
+	}
+}
+
+func Test_transferKeyOwnership_notOwner(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1"})
+	mockStub.Creator = newIdentity("Org2MSP", "user2", nil)
+	response := simpleCC.transferKeyOwnership(mockStub, []string{"key1", "user2", "Org2MSP"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 403 {
+		fmt.Println("transferKeyOwnership_notOwner test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getOwner_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getOwner(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound {
+		fmt.Println("getOwner_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setPrivate_notOwner(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret1")}
+	response := simpleCC.setPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("setPrivate_notOwner test failed")
+		t.FailNow()
+	}
+	mockStub.Creator = newIdentity("Org2MSP", "user2", nil)
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret2")}
+	response = simpleCC.setPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 403 || body.Code != errCodeForbidden {
+		fmt.Println("setPrivate_notOwner test failed")
+		t.FailNow()
+	}
+	if value := string(mockStub.PvtState["getSetPrivate"]["key1"]); value != "secret1" {
+		fmt.Println("setPrivate_notOwner test failed")
+		t.FailNow()
+	}
+}
+
+func Test_set_expired(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.set(mockStub, []string{"key1", "value1", "60"})
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("set_expired test failed")
+		t.FailNow()
+	}
+	response = simpleCC.get(mockStub, []string{"key1"})
+	if value := string(response.GetPayload()); value != "value1" {
+		fmt.Println("set_expired test failed")
+		t.FailNow()
+	}
+	mockStub.TxTimestamp.Seconds += 61
+	response = simpleCC.get(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound {
+		fmt.Println("set_expired test failed")
+		t.FailNow()
+	}
+}
+
+func Test_set_invalidExpiry(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.set(mockStub, []string{"key1", "value1", "tomorrow"})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("set_invalidExpiry test failed")
+		t.FailNow()
+	}
+	response = simpleCC.set(mockStub, []string{"key1", "value1", "2000-01-01T00:00:00Z"})
+	mockStub.MockTransactionEnd(txId)
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("set_invalidExpiry test failed")
+		t.FailNow()
+	}
+}
+
+func Test_purgeExpired(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"key1", "value1", "10s"})
+	simpleCC.set(mockStub, []string{"key2", "value2", "20s"})
+	simpleCC.set(mockStub, []string{"key3", "value3", "1h"})
+	simpleCC.set(mockStub, []string{"key4", "value4"})
+	mockStub.TxTimestamp.Seconds += 30
+	response := simpleCC.purgeExpired(mockStub, []string{"1"})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+	var result purgeResult
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || len(result.Purged) != 1 || result.Purged[0] != "key1" || !result.More {
+		fmt.Println("purgeExpired test failed")
+		t.FailNow()
+	}
+	response = simpleCC.purgeExpired(mockStub, []string{})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	result = purgeResult{}
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || len(result.Purged) != 1 || result.Purged[0] != "key2" || result.More {
+		fmt.Println("purgeExpired test failed")
+		t.FailNow()
+	}
+	if mockStub.State["key2"] != nil || mockStub.State["key3"] == nil || mockStub.State["key4"] == nil {
+		fmt.Println("purgeExpired test failed")
+		t.FailNow()
+	}
+}
+
+func Test_purgeExpired_invalidBatchSize(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.purgeExpired(mockStub, []string{"1000"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("purgeExpired_invalidBatchSize test failed")
+		t.FailNow()
+	}
+}
+
+// toArgs converts string arguments to the byte slices passed to MockInit and
+// MockInvoke
+func toArgs(args ...string) [][]byte {
+	argsAsBytes := make([][]byte, len(args))
+	for i, v := range args {
+		argsAsBytes[i] = []byte(v)
+	}
+	return argsAsBytes
+}
+
+// nextEvent returns the name and payload of the next chaincode event set by
+// the mockstub, or an empty name if none was set
+func nextEvent(mockStub *shim.MockStub) (string, changeEvent) {
+	select {
+	case event := <-mockStub.ChaincodeEventsChannel:
+		var payload changeEvent
+		json.Unmarshal(event.Payload, &payload)
+		return event.EventName, payload
+	default:
+		return "", changeEvent{}
+	}
+}
+
+func Test_Invoke_events(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	response := mockStub.MockInvoke(txId, toArgs("set", "key1", "value1"))
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("Invoke_events test failed")
+		t.FailNow()
+	}
+	name, event := nextEvent(mockStub)
+	fmt.Println("Event: " + name + " " + fmt.Sprint(event))
+	if name != eventKeySet || event.TxId != txId || event.MSPID != "Org1MSP" || len(event.Changes) != 1 ||
+		event.Changes[0].Key != "key1" || event.Changes[0].ValueHash != hashValue("value1") {
+		fmt.Println("Invoke_events test failed")
+		t.FailNow()
+	}
+
+	mockStub.MockInvoke(txId, toArgs("delete", "key1"))
+	name, event = nextEvent(mockStub)
+	fmt.Println("Event: " + name + " " + fmt.Sprint(event))
+	if name != eventKeyDeleted || len(event.Changes) != 1 || event.Changes[0].Key != "key1" || event.Changes[0].ValueHash != "" {
+		fmt.Println("Invoke_events test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Invoke_eventsKeysChanged(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "value1"))
+	nextEvent(mockStub)
+	ops := `[{"op": "set", "key": "key2", "value": "value2"}, {"op": "delete", "key": "key1"}]`
+	response := mockStub.MockInvoke(txId, toArgs("atomic", ops))
+	fmt.Println("Message: " + response.GetMessage())
+	name, event := nextEvent(mockStub)
+	fmt.Println("Event: " + name + " " + fmt.Sprint(event))
+	if name != eventKeysChanged || len(event.Changes) != 2 {
+		fmt.Println("Invoke_eventsKeysChanged test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Invoke_eventsPrefix(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"eventNamePrefix": "getset."}`))
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "value1"))
+	name, _ := nextEvent(mockStub)
+	fmt.Println("Event: " + name)
+	if name != "getset."+eventKeySet {
+		fmt.Println("Invoke_eventsPrefix test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Invoke_noEventOnError(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	response := mockStub.MockInvoke(txId, toArgs("set", "key1"))
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("Invoke_noEventOnError test failed")
+		t.FailNow()
+	}
+	mockStub.MockInvoke(txId, toArgs("get", "key1"))
+	if name, _ := nextEvent(mockStub); name != "" {
+		fmt.Println("Invoke_noEventOnError test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Init_invalidConfig(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	response := mockStub.MockInit(txId, toArgs("init", `{"maxValueSize": -1}`))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeInvalidArgument {
+		fmt.Println("Init_invalidConfig test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInit(txId, toArgs("init", "app1/"))
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("Init_invalidConfig test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Init_migration(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.State["app1/key1"] = []byte("value1")
+	mockStub.State["app2/key1"] = []byte("value2")
+	response := mockStub.MockInit(txId, toArgs("init", `{"namespace": "app1/"}`))
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("Init_migration test failed")
+		t.FailNow()
+	}
+
+	response = mockStub.MockInvoke(txId, toArgs("getWithVersion", "key1"))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	var result map[string]string
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result["value"] != "value1" || result["version"] != txId {
+		fmt.Println("Init_migration test failed")
+		t.FailNow()
+	}
+	if version, _ := mockStub.CreateCompositeKey(versionIndex, []string{"app2/key1"}); mockStub.State[version] != nil {
+		fmt.Println("Init_migration test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getVersion(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init"))
+	response := mockStub.MockInvoke(txId, toArgs("getVersion"))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	var version versionInfo
+	if err := json.Unmarshal(response.GetPayload(), &version); err != nil || version.Version != codeVersion || version.DataVersion != len(migrations) {
+		fmt.Println("getVersion test failed")
+		t.FailNow()
+	}
+}
+
+func Test_namespace(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"namespace": "app1/"}`))
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "value1", "60"))
+	mockStub.MockInvoke(txId, toArgs("increment", "counter1", "5", "delta"))
+	if value := string(mockStub.State["app1/key1"]); value != "value1" {
+		fmt.Println("namespace test failed")
+		t.FailNow()
+	}
+
+	// the records of the keys of app1/ must not be visible from app2/
+	mockStub.MockInit(txId, toArgs("init", `{"namespace": "app2/"}`))
+	mockStub.State["app2/key1"] = []byte("value2")
+	response := mockStub.MockInvoke(txId, toArgs("getOwner", "key1"))
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("namespace test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("get", "counter1"))
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("namespace test failed")
+		t.FailNow()
+	}
+	mockStub.MockTransactionStart(txId)
+	mockStub.TxTimestamp.Seconds += 120
+	response = new(SimpleAsset).get(mockStub, []string{"key1"})
+	if value := string(response.GetPayload()); value != "value2" {
+		fmt.Println("namespace test failed")
+		t.FailNow()
+	}
+	response = new(SimpleAsset).purgeExpired(mockStub, []string{})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	if value := string(response.GetPayload()); value != `{"purged":[],"more":false}` || mockStub.State["app1/key1"] == nil {
+		fmt.Println("namespace test failed")
+		t.FailNow()
+	}
+}
+
+func Test_namespace_schemas(t *testing.T) {
+	mockStub := newMockStub()
+	mockStub.Creator = newIdentity("Org1MSP", "admin1", map[string]string{"getset.admin": "true"})
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"namespace": "app1/"}`))
+	mockStub.MockInvoke(txId, toArgs("registerSchema", "count", "number"))
+	response := mockStub.MockInvoke(txId, toArgs("set", "count", "abc"))
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("namespace_schemas test failed")
+		t.FailNow()
+	}
+	mockStub.MockInit(txId, toArgs("init", `{"namespace": "app2/"}`))
+	response = mockStub.MockInvoke(txId, toArgs("set", "count", "abc"))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("namespace_schemas test failed")
+		t.FailNow()
+	}
+}
+
+func Test_set_chunked(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"chunkSize": 4}`))
+	response := mockStub.MockInvoke(txId, toArgs("set", "key1", "0123456789"))
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("set_chunked test failed")
+		t.FailNow()
+	}
+	var manifest chunkManifest
+	if err := json.Unmarshal(mockStub.State["key1"], &manifest); err != nil || manifest.Chunks != 3 || manifest.Size != 10 {
+		fmt.Println("set_chunked test failed")
+		t.FailNow()
+	}
+
+	response = mockStub.MockInvoke(txId, toArgs("get", "key1"))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	if value := string(response.GetPayload()); value != "0123456789" {
+		fmt.Println("set_chunked test failed")
+		t.FailNow()
+	}
+
+	// a small value replaces the chunks
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "abc"))
+	mockStub.MockTransactionStart(txId)
+	chunkKey, _ := recordKey(mockStub, chunkIndex, "key1", "000000")
+	mockStub.MockTransactionEnd(txId)
+	response = mockStub.MockInvoke(txId, toArgs("get", "key1"))
+	if value := string(response.GetPayload()); value != "abc" || mockStub.State[chunkKey] != nil {
+		fmt.Println("set_chunked test failed")
+		t.FailNow()
+	}
+}
+
+func Test_set_chunkedTampered(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"chunkSize": 4}`))
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "0123456789"))
+	mockStub.MockTransactionStart(txId)
+	chunkKey, _ := recordKey(mockStub, chunkIndex, "key1", "000001")
+	mockStub.MockTransactionEnd(txId)
+	mockStub.State[chunkKey] = []byte("xxxx")
+
+	response := mockStub.MockInvoke(txId, toArgs("get", "key1"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 500 {
+		fmt.Println("set_chunkedTampered test failed")
+		t.FailNow()
+	}
+}
+
+func Test_delete_chunked(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"chunkSize": 4}`))
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "0123456789"))
+	response := mockStub.MockInvoke(txId, toArgs("delete", "key1"))
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("delete_chunked test failed")
+		t.FailNow()
+	}
+	if mockStub.State["key1"] != nil {
+		fmt.Println("delete_chunked test failed")
+		t.FailNow()
+	}
+	for key := range mockStub.State {
+		if _, attributes, _ := mockStub.SplitCompositeKey(key); len(attributes) > 0 && attributes[0] == "key1" {
+			fmt.Println("delete_chunked test failed: record left " + key)
+			t.FailNow()
+		}
+	}
+}
+
+func Test_setPrivate(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret1")}
+	response := simpleCC.setPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if value := string(response.GetPayload()); value != "key1:"+hashValue("secret1") {
+		fmt.Println("setPrivate test failed")
+		t.FailNow()
+	}
+	if value := string(mockStub.PvtState["getSetPrivate"]["key1"]); value != "secret1" || mockStub.State["key1"] != nil {
+		fmt.Println("setPrivate test failed")
+		t.FailNow()
+	}
+}
+
+func Test_setPrivate_noTransientValue(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.setPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeInvalidArgument {
+		fmt.Println("setPrivate_noTransientValue test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getPrivate(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret1")}
+	simpleCC.setPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	response := simpleCC.getPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+
+	if value := string(response.GetPayload()); value != "secret1" {
+		fmt.Println("getPrivate test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getPrivate_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound {
+		fmt.Println("getPrivate_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_verifyPrivateHash(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := &privateHashStub{MockStub: newMockStub()}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret1")}
+	simpleCC.setPrivate(mockStub, []string{"getSetPrivate", "key1"})
+	response := simpleCC.verifyPrivateHash(mockStub, []string{"getSetPrivate", "key1"})
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	var result privateHashResult
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || !result.Match || result.Hash != hashValue("secret1") {
+		fmt.Println("verifyPrivateHash test failed")
+		t.FailNow()
+	}
+
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret2")}
+	response = simpleCC.verifyPrivateHash(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	result = privateHashResult{}
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Match {
+		fmt.Println("verifyPrivateHash test failed")
+		t.FailNow()
+	}
+}
+
+func Test_verifyPrivateHash_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := &privateHashStub{MockStub: newMockStub()}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	mockStub.TransientMap = map[string][]byte{"value": []byte("secret1")}
+	response := simpleCC.verifyPrivateHash(mockStub, []string{"getSetPrivate", "key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound {
+		fmt.Println("verifyPrivateHash_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_atomic(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"a", "100"})
+	simpleCC.set(mockStub, []string{"c", "value"})
+	operations := `[{"op": "assert", "key": "a", "value": "100"}, {"op": "increment", "key": "a", "delta": -30},
+		{"op": "increment", "key": "b", "delta": 30}, {"op": "delete", "key": "c"}]`
+	response := simpleCC.atomic(mockStub, []string{operations})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("atomic test failed")
+		t.FailNow()
+	}
+	mockStub.MockTransactionEnd(txId)
+	if string(mockStub.State["a"]) != "70" || string(mockStub.State["b"]) != "30" || mockStub.State["c"] != nil {
+		fmt.Println("atomic test failed")
+		t.FailNow()
+	}
+}
+
+func Test_atomic_assertFailed(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"a", "100"})
+	operations := `[{"op": "set", "key": "b", "value": "1"}, {"op": "assert", "key": "a", "value": "99"}]`
+	response := simpleCC.atomic(mockStub, []string{operations})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	body := parseError(response)
+	details, _ := body.Details.(map[string]interface{})
+	if response.GetStatus() != 409 || body.Code != errCodeConflict || details["index"] != float64(1) {
+		fmt.Println("atomic_assertFailed test failed")
+		t.FailNow()
+	}
+	if mockStub.State["b"] != nil {
+		fmt.Println("atomic_assertFailed test failed")
+		t.FailNow()
+	}
+}
+
+func Test_atomic_deleteMissing(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.atomic(mockStub, []string{`[{"op": "delete", "key": "a"}]`})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound {
+		fmt.Println("atomic_deleteMissing test failed")
+		t.FailNow()
+	}
+}
+
+func Test_atomic_invalidJSON(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.atomic(mockStub, []string{`{"op": "set"}`})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeInvalidArgument {
+		fmt.Println("atomic_invalidJSON test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInvoke(txId, toArgs("set", "counter1", "10"))
+	response := mockStub.MockInvoke(txId, toArgs("increment", "counter1", "5"))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	if value := string(response.GetPayload()); value != "15" {
+		fmt.Println("increment test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("decrement", "counter2", "3"))
+	if value := string(response.GetPayload()); value != "-3" {
+		fmt.Println("increment test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_delta(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInvoke(txId, toArgs("set", "counter1", "10"))
+	mockStub.MockInvoke("tx1", toArgs("increment", "counter1", "5", "delta"))
+	response := mockStub.MockInvoke("tx2", toArgs("decrement", "counter1", "2", "delta"))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	if value := string(response.GetPayload()); value != "-2" || string(mockStub.State["counter1"]) != "10" {
+		fmt.Println("increment_delta test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("get", "counter1"))
+	if value := string(response.GetPayload()); value != "13" {
+		fmt.Println("increment_delta test failed")
+		t.FailNow()
+	}
+
+	// an increment in value mode folds the pending deltas into the value
+	response = mockStub.MockInvoke(txId, toArgs("increment", "counter1", "1"))
+	if value := string(response.GetPayload()); value != "14" || string(mockStub.State["counter1"]) != "14" {
+		fmt.Println("increment_delta test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_deltaNotInteger(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInvoke(txId, toArgs("set", "key1", "value1"))
+	response := mockStub.MockInvoke(txId, toArgs("increment", "key1", "5", "delta"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 409 || body.Code != errCodeConflict {
+		fmt.Println("increment_deltaNotInteger test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("get", "key1"))
+	if value := string(response.GetPayload()); value != "value1" {
+		fmt.Println("increment_deltaNotInteger test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_deltaSchema(t *testing.T) {
+	mockStub := newMockStub()
+	mockStub.Creator = newIdentity("Org1MSP", "admin1", map[string]string{"getset.admin": "true"})
+	txId := "mockTxID"
+
+	mockStub.MockInvoke(txId, toArgs("registerSchema", "stock/", `{"type": "integer", "minimum": 0}`))
+	mockStub.MockInvoke(txId, toArgs("set", "stock/1", "3"))
+	response := mockStub.MockInvoke(txId, toArgs("decrement", "stock/1", "5", "delta"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeSchemaViolation {
+		fmt.Println("increment_deltaSchema test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_deltaValueSize(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockInit(txId, toArgs("init", `{"maxValueSize": 2}`))
+	mockStub.MockInvoke(txId, toArgs("set", "counter1", "95"))
+	response := mockStub.MockInvoke(txId, toArgs("increment", "counter1", "10", "delta"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeValueTooLarge {
+		fmt.Println("increment_deltaValueSize test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_deltaAggregateSchema(t *testing.T) {
+	mockStub := newMockStub()
+	mockStub.Creator = newIdentity("Org1MSP", "admin1", map[string]string{"getset.admin": "true"})
+	txId := "mockTxID"
+
+	mockStub.MockInvoke(txId, toArgs("registerSchema", "stock/", `{"type": "integer", "minimum": 0}`))
+	mockStub.MockInvoke(txId, toArgs("set", "stock/1", "5"))
+	mockStub.MockInvoke("tx1", toArgs("decrement", "stock/1", "3", "delta"))
+	response := mockStub.MockInvoke("tx2", toArgs("decrement", "stock/1", "3", "delta"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeSchemaViolation {
+		fmt.Println("increment_deltaAggregateSchema test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("get", "stock/1"))
+	if value := string(response.GetPayload()); value != "2" {
+		fmt.Println("increment_deltaAggregateSchema test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_deltaExpired(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	simpleCC.set(mockStub, []string{"counter1", "10", "60"})
+	mockStub.TxTimestamp.Seconds += 61
+	response := simpleCC.increment(mockStub, "increment", []string{"counter1", "5", "delta"}, 1)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 409 || body.Code != errCodeConflict {
+		fmt.Println("increment_deltaExpired test failed")
+		t.FailNow()
+	}
+
+	// once purged, the key counts as 0 again
+	simpleCC.purgeExpired(mockStub, []string{})
+	response = simpleCC.increment(mockStub, "increment", []string{"counter1", "5", "delta"}, 1)
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("increment_deltaExpired test failed")
+		t.FailNow()
+	}
+	response = simpleCC.get(mockStub, []string{"counter1"})
+	mockStub.MockTransactionEnd(txId)
+	if value := string(response.GetPayload()); value != "5" {
+		fmt.Println("increment_deltaExpired test failed")
+		t.FailNow()
+	}
+}
+
+func Test_increment_invalidDelta(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	response := mockStub.MockInvoke(txId, toArgs("increment", "counter1", "1.5"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeInvalidArgument {
+		fmt.Println("increment_invalidDelta test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("increment", "counter1", "1", "sum"))
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("increment_invalidDelta test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Invoke_errorBody(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	response := mockStub.MockInvoke(txId, toArgs("set", "key1", "value1", "60", "extra"))
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(response.GetMessage()), &body); err != nil {
+		fmt.Println("Invoke_errorBody test failed")
+		t.FailNow()
+	}
+	details, _ := body["details"].(map[string]interface{})
+	if response.GetStatus() != 400 || body["code"] != errCodeArgCount || body["function"] != "set" ||
+		details["expected"] != "2 or 3" || details["given"] != float64(4) {
+		fmt.Println("Invoke_errorBody test failed")
+		t.FailNow()
+	}
+
+	response = mockStub.MockInvoke(txId, toArgs("get", "key1"))
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound || body.Function != "get" {
+		fmt.Println("Invoke_errorBody test failed")
+		t.FailNow()
+	}
+	response = mockStub.MockInvoke(txId, toArgs("noFunction"))
+	if body := parseError(response); body.Code != errCodeUnknownFunction || body.Function != "noFunction" {
+		fmt.Println("Invoke_errorBody test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Init_errorBody(t *testing.T) {
+	mockStub := newMockStub()
+	txId := "mockTxID"
+
+	response := mockStub.MockInit(txId, toArgs("init", "{}", "{}"))
+	fmt.Println("Message: " + response.GetMessage())
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeArgCount || body.Function != "init" {
+		fmt.Println("Init_errorBody test failed")
+		t.FailNow()
+	}
+}
+
+func Test_parseError(t *testing.T) {
+	body := parseError(shim.Error("Incorrect number of arguments."))
+	if body.Code != errCodeInternal || body.Message != "Incorrect number of arguments." {
+		fmt.Println("parseError test failed")
+		t.FailNow()
+	}
+	if response := withFunction("get", shim.Success([]byte("value1"))); string(response.GetPayload()) != "value1" || response.GetMessage() != "" {
+		fmt.Println("parseError test failed")
+		t.FailNow()
+	}
+}
+
+// newAsOfStub returns a historyStub where key1 was set to value1 at
+// 2019-01-01T00:00:00Z by tx1, set to value2 with a 60 seconds TTL at
+// 2019-01-01T00:10:00Z by tx2 and deleted at 2019-01-01T01:00:00Z by tx3
+func newAsOfStub() *historyStub {
+	mockStub := newHistoryStub()
+	mockStub.histories["key1"] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: []byte("value1"), Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+		{TxId: "tx2", Value: []byte("value2"), Timestamp: &timestamp.Timestamp{Seconds: 1546301400}},
+		{TxId: "tx3", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546304400}},
+	}
+	expiryKey, _ := mockStub.CreateCompositeKey(expiryIndex, []string{"key1"})
+	mockStub.histories[expiryKey] = []*queryresult.KeyModification{
+		{TxId: "tx2", Value: []byte("2019-01-01T00:11:00Z"), Timestamp: &timestamp.Timestamp{Seconds: 1546301400}},
+		{TxId: "tx3", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546304400}},
+	}
+	return mockStub
+}
+
+func Test_getAsOf(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newAsOfStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getAsOf(mockStub, []string{"key1", "2019-01-01T00:05:00Z"})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+	var result asOfValue
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Value != "value1" || result.TxId != "tx1" {
+		fmt.Println("getAsOf test failed")
+		t.FailNow()
+	}
+
+	response = simpleCC.getAsOf(mockStub, []string{"key1", "tx2"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	result = asOfValue{}
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Value != "value2" || result.ExpiresAt != "2019-01-01T00:11:00Z" {
+		fmt.Println("getAsOf test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getAsOf_notFound(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newAsOfStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	defer mockStub.MockTransactionEnd(txId)
+	for at, state := range map[string]string{
+		"2018-12-31T00:00:00Z": "notCreated",
+		"2019-01-01T00:30:00Z": "expired",
+		"2019-01-02T00:00:00Z": "deleted",
+	} {
+		response := simpleCC.getAsOf(mockStub, []string{"key1", at})
+		fmt.Println("Message: " + response.GetMessage())
+		body := parseError(response)
+		details, _ := body.Details.(map[string]interface{})
+		if response.GetStatus() != 400 || body.Code != errCodeNotFound || details["state"] != state {
+			fmt.Println("getAsOf_notFound test failed for " + at)
+			t.FailNow()
+		}
+	}
+	response := simpleCC.getAsOf(mockStub, []string{"key1", "tx4"})
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeNotFound {
+		fmt.Println("getAsOf_notFound test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getAsOf_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newAsOfStub()
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getAsOf(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if body := parseError(response); response.GetStatus() != 400 || body.Code != errCodeArgCount {
+		fmt.Println("getAsOf_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistory_chunked(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	manifest, _ := json.Marshal(chunkManifest{Chunks: 2, Size: 8, SHA256: hashValue("01234567")})
+	mockStub.histories["key1"] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: manifest, Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+		{TxId: "tx2", Value: []byte("abc"), Timestamp: &timestamp.Timestamp{Seconds: 1546300900}},
+	}
+	chunkedKey, _ := mockStub.CreateCompositeKey(chunkedIndex, []string{"key1"})
+	mockStub.histories[chunkedKey] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: []byte{0x00}, Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+		{TxId: "tx2", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546300900}},
+	}
+	for i, chunk := range []string{"0123", "4567"} {
+		chunkKey, _ := mockStub.CreateCompositeKey(chunkIndex, []string{"key1", fmt.Sprintf("%06d", i)})
+		mockStub.histories[chunkKey] = []*queryresult.KeyModification{
+			{TxId: "tx1", Value: []byte(chunk), Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+			{TxId: "tx2", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546300900}},
+		}
+	}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistory(mockStub, []string{"key1"})
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	var history []historyEntry
+	if err := json.Unmarshal(response.GetPayload(), &history); err != nil || len(history) != 2 || *history[0].Value != "01234567" || *history[1].Value != "abc" {
+		fmt.Println("getHistory_chunked test failed")
+		t.FailNow()
+	}
+
+	response = simpleCC.getAsOf(mockStub, []string{"key1", "tx1"})
+	mockStub.MockTransactionEnd(txId)
+	var result asOfValue
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Value != "01234567" {
+		fmt.Println("getHistory_chunked test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistory_counterDeltas(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	mockStub.histories["counter1"] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: []byte("10"), Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+		{TxId: "tx4", Value: []byte("18"), Timestamp: &timestamp.Timestamp{Seconds: 1546301100}},
+	}
+	counterKey, _ := mockStub.CreateCompositeKey(counterIndex, []string{"counter1"})
+	mockStub.histories[counterKey] = []*queryresult.KeyModification{
+		{TxId: "tx2", Value: []byte("true"), Timestamp: &timestamp.Timestamp{Seconds: 1546300900}},
+		{TxId: "tx3", Value: []byte("true"), Timestamp: &timestamp.Timestamp{Seconds: 1546301000}},
+		{TxId: "tx4", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546301100}},
+	}
+	for txID, delta := range map[string]string{"tx2": "5", "tx3": "2"} {
+		deltaKey, _ := mockStub.CreateCompositeKey(counterDeltaIndex, []string{"counter1", txID})
+		mockStub.histories[deltaKey] = []*queryresult.KeyModification{
+			{TxId: txID, Value: []byte(delta), Timestamp: &timestamp.Timestamp{Seconds: 1546300900}},
+			{TxId: "tx4", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 1546301100}},
+		}
+	}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistory(mockStub, []string{"counter1"})
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	var history []historyEntry
+	if err := json.Unmarshal(response.GetPayload(), &history); err != nil || len(history) != 4 {
+		fmt.Println("getHistory_counterDeltas test failed")
+		t.FailNow()
+	}
+	if history[1].TxId != "tx2" || *history[1].Delta != 5 || *history[1].Value != "15" || *history[2].Value != "17" || *history[3].Value != "18" {
+		fmt.Println("getHistory_counterDeltas test failed")
+		t.FailNow()
+	}
+
+	response = simpleCC.getAsOf(mockStub, []string{"counter1", "2019-01-01T00:04:00Z"})
+	mockStub.MockTransactionEnd(txId)
+	var result asOfValue
+	if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Value != "17" || result.TxId != "tx3" {
+		fmt.Println("getHistory_counterDeltas test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistory_chunkedTampered(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	manifest, _ := json.Marshal(chunkManifest{Chunks: 1, Size: 4, SHA256: hashValue("0123")})
+	mockStub.histories["key1"] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: manifest, Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+	}
+	chunkedKey, _ := mockStub.CreateCompositeKey(chunkedIndex, []string{"key1"})
+	mockStub.histories[chunkedKey] = []*queryresult.KeyModification{
+		{TxId: "tx1", Value: []byte{0x00}, Timestamp: &timestamp.Timestamp{Seconds: 1546300800}},
+	}
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistory(mockStub, []string{"key1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 500 {
+		fmt.Println("getHistory_chunkedTampered test failed")
+		t.FailNow()
+	}
+}
@@ -24,28 +24,572 @@
 package main
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
 	"github.com/hyperledger/fabric/protos/peer"
 )
 
 var logger = shim.NewLogger("zapierCC")
 
+// tenantIndex is the composite key index under which events are stored in
+// the namespace of their tenant, so that keys of different tenants never
+// collide
+const tenantIndex = "tenant~key"
+
+// streamIndex is the composite key index under which events saved in
+// append-only mode are stored, so that earlier events of a key are never
+// overwritten and a stream can be listed with a partial key query
+const streamIndex = "tenant~stream~key~timestamp~txID"
+
+// streamTimeIndex orders the events of each stream by time, newest first, so
+// that getEventsByStream reads a time range with a single bounded range
+// query. Range queries only accept simple keys, so the keys of
+// streamTimeIndex and savedIndex are composite keys whose leading null
+// character is replaced by rangeKeyPrefix.
+const (
+	streamTimeIndex = "tenant~stream~inverseTime~key~txID"
+	rangeKeyPrefix  = "~"
+)
+
+// metaField is the reserved field of stored events holding the metadata
+// stamped by the smart contract. It is not named _meta: CouchDB reserves top
+// level fields starting with an underscore and rejects documents holding any
+// other such field, so these events could not be stored on CouchDB peers.
+// rawField holds payloads that are not JSON objects, such as form-encoded data.
+const (
+	metaField = "~meta"
+	rawField  = "raw"
+)
+
+// eventTimestampFormat is the fixed width layout of the transaction timestamp
+// in the composite keys of streamIndex and in the metadata of stored events,
+// so that they sort in time order
+const eventTimestampFormat = "2006-01-02T15:04:05.000000000Z"
+
+// configIndex is the composite key under which the configuration passed to
+// Init is stored
+const configIndex = "config"
+
+// defaultIdempotencyRetention is how long processed idempotency keys are
+// remembered, unless another retention is configured
+const defaultIdempotencyRetention = 24 * time.Hour
+
+// idempotencyIndex is the composite key index of the idempotency keys
+// processed by saveNewEvent. idempotencyTimeIndex orders them by processing
+// time, so that purgeIdempotencyKeys can remove the expired ones first.
+const (
+	idempotencyIndex     = "idempotency~tenant~key"
+	idempotencyTimeIndex = "idempotency~timestamp~tenant~key"
+)
+
+// maxPurgeSize caps the number of idempotency keys removed by a single
+// purgeIdempotencyKeys transaction
+const maxPurgeSize = 500
+
+// compactionIndex is the composite key index of the summaries of the events
+// removed by compactEvents. maxCompactSize caps the number of events removed
+// by a single compactEvents transaction.
+const (
+	compactionIndex = "compaction~tenant~txID"
+	maxCompactSize  = 500
+)
+
+// retentionIndex is the composite key index of the retention entries queued
+// by saveNewEvent, ordered by the time at which they are due, so that
+// compactEvents only reads the entries that are due instead of every event.
+// retentionAge entries expire a single event once its retention days have
+// passed, retentionCount entries the events of a key of a stream beyond the
+// number of events kept.
+const (
+	retentionIndex = "retention~dueAt~txID~kind"
+	retentionAge   = "age"
+	retentionCount = "count"
+)
+
+// savedIndex lists every event saved by saveNewEvent in the order in which
+// it was saved, whether or not a retention policy applies to it. When Init
+// changes the retention policies, it stores the first key of savedIndex under
+// reindexIndex, and compactEvents queues the retention entries of the listed
+// events again from there, so that the new policies also apply to the events
+// saved before.
+const (
+	savedIndex   = "saved~timestamp~txID"
+	reindexIndex = "reindex"
+)
+
+// defaultTenantAttribute is the client certificate attribute naming the
+// tenant of the caller within its MSP, and defaultAuditorAttribute the one
+// that, when set to "true", grants access to the events of every tenant,
+// unless other attributes are configured
+const (
+	defaultTenantAttribute  = "zapier.tenant"
+	defaultAuditorAttribute = "zapier.auditor"
+)
+
+// pendingIndex is the composite key index of the hashes of the saved events
+// waiting to be anchored, in time order. anchorEvents anchors them in
+// batches stored under batchIndex, the number of the latest batch being
+// stored under latestBatchIndex, and records the position of each event in
+// its batch under proofIndex. maxAnchorSize caps the size of a batch.
+const (
+	pendingIndex     = "anchor~timestamp~txID"
+	batchIndex       = "batch~number"
+	latestBatchIndex = "batch~latest"
+	proofIndex       = "proof~tenant~key~txID"
+	maxAnchorSize    = 500
+)
+
+// defaultEventName is the name of the chaincode event emitted by
+// saveNewEvent for events saved without an event type. Events saved with a
+// type are named after it, prefixed by defaultEventNamePrefix unless another
+// prefix is configured.
+const (
+	defaultEventName       = "saveNewEvent"
+	defaultEventNamePrefix = "zapier."
+)
+
+// Emit modes of the chaincode event of saveNewEvent: emitPayload emits the
+// stored event, emitHash its metadata and SHA-256 hash, and emitMetadata
+// only its metadata
+const (
+	emitPayload  = "payload"
+	emitHash     = "hash"
+	emitMetadata = "metadata"
+)
+
+// subscriptionIndex is the composite key index of the subscriptions
+// registered by subscribe, keyed by tenant so that saveNewEvent only reads
+// the subscriptions of the tenant of the saved event. Saved events matching a subscription are queued
+// under queueIndex until acknowledged, the last acknowledged event being
+// stored under ackIndex apart from the subscription, so that
+// acknowledgements do not conflict with saveNewEvent reading the
+// subscriptions. Both are keyed by tenant too, so that a subscription id
+// only reaches the queue of its own tenant. unsubscribedIndex records the
+// subscriptions removed by unsubscribe while queued events remain.
+// maxPendingSize caps the number of queued events returned by
+// getPendingEvents or removed by unsubscribe at once.
+const (
+	subscriptionIndex = "subscription~tenant~id"
+	queueIndex        = "queue~tenant~subscription~timestamp~txID"
+	ackIndex          = "ack~tenant~subscription"
+	unsubscribedIndex = "unsubscribed~tenant~subscription"
+	maxPendingSize    = 500
+)
+
+// sourceField is the field of stored events naming the application that
+// logged them, such as "Event" for the SmartThings logger
+const sourceField = "docType"
+
 // SimpleAsset implements a simple smart contract to manage an asset
 type SimpleAsset struct {
 }
 
+// chaincodeConfig is the configuration optionally passed to Init as a JSON
+// object. IdempotencyRetention is a duration such as "72h" during which
+// saveNewEvent remembers processed idempotency keys; "0" keeps them forever.
+// TenantAttribute and AuditorAttribute name the certificate attributes
+// holding the tenant of the caller and marking auditors. RetentionPolicies
+// are applied by compactEvents, the first policy matching an event applying.
+// EventNamePrefix prefixes the type of saved events to name their chaincode
+// event; it is a pointer so that an empty prefix can be told apart from an
+// absent one. EventEmit is the emit mode of that event.
+type chaincodeConfig struct {
+	IdempotencyRetention string            `json:"idempotencyRetention,omitempty"`
+	TenantAttribute      string            `json:"tenantAttribute,omitempty"`
+	AuditorAttribute     string            `json:"auditorAttribute,omitempty"`
+	RetentionPolicies    []retentionPolicy `json:"retentionPolicies,omitempty"`
+	EventNamePrefix      *string           `json:"eventNamePrefix,omitempty"`
+	EventEmit            string            `json:"eventEmit,omitempty"`
+	LegacyTenant         string            `json:"legacyTenant,omitempty"`
+}
+
+// retentionPolicy limits how long the events of the keys starting with
+// KeyPrefix, and whose type is EventType when set, are kept by
+// compactEvents: MaxEvents keeps the last events of each key and MaxDays the
+// events saved during the last days. Zero means no limit.
+type retentionPolicy struct {
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	EventType string `json:"eventType,omitempty"`
+	MaxEvents int    `json:"maxEvents,omitempty"`
+	MaxDays   int    `json:"maxDays,omitempty"`
+}
+
+// storedEvent is an event read from the ledger by compactEvents. Stream is
+// empty for events stored under the key of the tenant.
+type storedEvent struct {
+	archivedEvent
+	stateKey  string
+	tenant    string
+	timestamp time.Time
+	value     []byte
+}
+
+// archivedEvent identifies an event removed by compactEvents
+type archivedEvent struct {
+	Stream    string `json:"stream,omitempty"`
+	Key       string `json:"key"`
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// retentionEntry identifies the event, or the key of a stream, that a
+// retention entry may expire
+type retentionEntry struct {
+	Tenant    string `json:"tenant"`
+	Stream    string `json:"stream,omitempty"`
+	Key       string `json:"key"`
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// compactionSummary is stored for each tenant whose events are removed by a
+// compactEvents transaction. MerkleRoot is the root of the Merkle tree of the
+// removed values, in the order of Events, so that any of them can still be
+// proven against the ledger history.
+type compactionSummary struct {
+	Tenant         string          `json:"tenant"`
+	TxId           string          `json:"txId"`
+	Count          int             `json:"count"`
+	FirstTimestamp string          `json:"firstTimestamp"`
+	LastTimestamp  string          `json:"lastTimestamp"`
+	MerkleRoot     string          `json:"merkleRoot"`
+	Events         []archivedEvent `json:"events"`
+}
+
+// compactResult is the response payload of compactEvents. More is true if
+// expired events remain.
+type compactResult struct {
+	Compacted int                 `json:"compacted"`
+	Reindexed int                 `json:"reindexed,omitempty"`
+	More      bool                `json:"more"`
+	Summaries []compactionSummary `json:"summaries"`
+}
+
+// callerIdentity is the identity submitting the transaction. Tenant is the
+// MSP id of the caller, followed by "/" and the value of the tenant attribute
+// when its certificate carries one.
+type callerIdentity struct {
+	MSPID   string
+	Tenant  string
+	Auditor bool
+}
+
+// idempotencyRecord is stored for every idempotency key processed by
+// saveNewEvent. Result is the payload returned to the original request.
+type idempotencyRecord struct {
+	Result    string `json:"result"`
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// purgeResult is the response payload of purgeIdempotencyKeys. More is true
+// if expired idempotency keys remain.
+type purgeResult struct {
+	Purged int  `json:"purged"`
+	More   bool `json:"more"`
+}
+
+// eventMeta is the metadata stamped under the metaField of every stored event
+type eventMeta struct {
+	TxId       string `json:"txId"`
+	Timestamp  string `json:"timestamp"`
+	CreatorMSP string `json:"creatorMSP"`
+	Tenant     string `json:"tenant"`
+	Type       string `json:"type,omitempty"`
+}
+
+// emittedEvent is the payload of the chaincode event of saveNewEvent in the
+// hash and metadata emit modes
+type emittedEvent struct {
+	Tenant    string `json:"tenant"`
+	Key       string `json:"key"`
+	Stream    string `json:"stream,omitempty"`
+	Type      string `json:"type,omitempty"`
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+// streamEvent is a single event of a stream reported by getEventsByStream.
+// Value holds the event as-is when it is JSON and as a JSON string otherwise.
+type streamEvent struct {
+	Tenant    string          `json:"tenant"`
+	Stream    string          `json:"stream"`
+	Key       string          `json:"key"`
+	Timestamp string          `json:"timestamp"`
+	TxId      string          `json:"txId"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// eventsPage is the response payload of getEventsByStream
+type eventsPage struct {
+	Events              []streamEvent `json:"events"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// queryRecord is a single event matching a rich query. Tenant is set for
+// events stored in a tenant namespace and Stream for events appended to a
+// stream, in which case Key is the key of the event within them.
+type queryRecord struct {
+	Key    string          `json:"key"`
+	Tenant string          `json:"tenant,omitempty"`
+	Stream string          `json:"stream,omitempty"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// queryPage is the response payload of queryEvents and of the parameterized
+// queries built on it
+type queryPage struct {
+	Records             []queryRecord `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// pendingLeaf is the hash of a saved event waiting to be anchored
+type pendingLeaf struct {
+	Tenant string `json:"tenant"`
+	Key    string `json:"key"`
+	TxId   string `json:"txId"`
+	Hash   string `json:"hash"`
+}
+
+// anchorBatch is a batch of event hashes anchored by anchorEvents. TreeRoot
+// is the root of the Merkle tree of Leaves and PreviousRoot the root of the
+// previous batch. Root hashes both, chaining the batches together. Batches
+// are numbered from 1.
+type anchorBatch struct {
+	Number       int      `json:"number"`
+	Root         string   `json:"root"`
+	TreeRoot     string   `json:"treeRoot"`
+	PreviousRoot string   `json:"previousRoot"`
+	TxId         string   `json:"txId"`
+	Timestamp    string   `json:"timestamp"`
+	Leaves       []string `json:"leaves"`
+}
+
+// proofRecord is the position of an anchored event in its batch
+type proofRecord struct {
+	Batch int `json:"batch"`
+	Index int `json:"index"`
+}
+
+// anchorResult is the response payload of anchorEvents. More is true if
+// events remain to be anchored.
+type anchorResult struct {
+	Anchored int    `json:"anchored"`
+	More     bool   `json:"more"`
+	Batch    int    `json:"batch,omitempty"`
+	Root     string `json:"root,omitempty"`
+}
+
+// proofStep is a sibling on the path from a leaf to the root of a Merkle
+// tree. Left is true if the sibling is the left node of the pair.
+type proofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+// eventProof is the inclusion proof of an event returned by getEventProof.
+// Leaf is the hash of the tenant, key and txID of the event and of the event
+// as stored.
+type eventProof struct {
+	Tenant       string      `json:"tenant"`
+	Key          string      `json:"key"`
+	TxId         string      `json:"txId"`
+	Leaf         string      `json:"leaf"`
+	Batch        int         `json:"batch"`
+	Root         string      `json:"root"`
+	TreeRoot     string      `json:"treeRoot"`
+	PreviousRoot string      `json:"previousRoot"`
+	Path         []proofStep `json:"path"`
+}
+
+// verifyResult is the response payload of verifyEventProof. Root is the root
+// of the batch as anchored on the ledger, and Key and TxId identify the
+// verified event.
+type verifyResult struct {
+	Valid bool   `json:"valid"`
+	Key   string `json:"key"`
+	TxId  string `json:"txId"`
+	Batch int    `json:"batch"`
+	Root  string `json:"root"`
+}
+
+// subscription maps the events of a tenant whose type matches EventType to
+// the identifier of a delivery target, such as a webhook URL identifier. An
+// empty EventType matches every event and a trailing "*" any type starting
+// with the preceding characters. Id is the txID of the subscribe transaction.
+type subscription struct {
+	Id        string `json:"id"`
+	Tenant    string `json:"tenant"`
+	EventType string `json:"eventType"`
+	Target    string `json:"target"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ackRecord is the last event acknowledged for a subscription
+type ackRecord struct {
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+// pendingEvent is a saved event queued for a subscription
+type pendingEvent struct {
+	emittedEvent
+	Value json.RawMessage `json:"value"`
+}
+
+// pendingPage is the response payload of getPendingEvents. More is true if
+// more events are pending than returned.
+type pendingPage struct {
+	Subscription subscription   `json:"subscription"`
+	LastAcked    *ackRecord     `json:"lastAcked"`
+	Events       []pendingEvent `json:"events"`
+	More         bool           `json:"more"`
+}
+
+// ackResult is the response payload of ackEvents and unsubscribe, Removed
+// being the number of queued events removed. More is true if unsubscribe
+// left queued events to remove.
+type ackResult struct {
+	Removed int  `json:"removed"`
+	More    bool `json:"more,omitempty"`
+}
+
+// historyEntry is a single modification of a key reported by getHistoryByKey,
+// in the format of the marbles getHistoryForMarble function. Value holds the
+// event as-is when it is JSON and as a JSON string otherwise; it is null when
+// the modification was a delete.
+type historyEntry struct {
+	TxId      string          `json:"TxId"`
+	Value     json.RawMessage `json:"Value"`
+	Timestamp string          `json:"Timestamp"`
+	IsDelete  string          `json:"IsDelete"`
+}
+
 // Init is called during smart contract instantiation to initialize any
 // data. Note that smart contract upgrade also calls this function to reset
 // or to migrate data.
+// An optional JSON configuration such as {"idempotencyRetention": "72h"} may
+// be passed as argument; without it the stored configuration is kept.
 func (t *SimpleAsset) Init(stub shim.ChaincodeStubInterface) peer.Response {
 	logger.Debug("Init() called.")
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) > 1 {
+		logger.Error("Incorrect number of arguments passed in Init.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 0 or 1 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+
+	var config chaincodeConfig
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		logger.Error("Error occured while parsing Init configuration: ", err)
+		resp := shim.Error("Configuration must be a JSON object: " + err.Error())
+		resp.Status = 400
+		return resp
+	}
+	if _, err := idempotencyRetention(config); err != nil {
+		resp := shim.Error("idempotencyRetention must be a non-negative duration such as \"24h\": " + config.IdempotencyRetention + " given.")
+		resp.Status = 400
+		return resp
+	}
+	for _, policy := range config.RetentionPolicies {
+		if policy.MaxEvents < 0 || policy.MaxDays < 0 || (policy.MaxEvents == 0 && policy.MaxDays == 0) {
+			resp := shim.Error("Retention policies must keep a positive number of events or days.")
+			resp.Status = 400
+			return resp
+		}
+	}
+	if config.EventEmit != "" && config.EventEmit != emitPayload && config.EventEmit != emitHash && config.EventEmit != emitMetadata {
+		resp := shim.Error("eventEmit must be payload, hash or metadata: " + config.EventEmit + " given.")
+		resp.Status = 400
+		return resp
+	}
+	previous, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return shim.Error("Failed to read configuration.")
+	}
+	configAsBytes, err := json.Marshal(config)
+	if err != nil {
+		logger.Error("Error occured while marshalling configuration: ", err)
+		return shim.Error("Failed to marshal configuration.")
+	}
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{})
+	if err == nil {
+		err = stub.PutState(configKey, configAsBytes)
+	}
+	if err != nil {
+		logger.Error("Error occured while storing configuration: ", err)
+		return shim.Error("Failed to store configuration.")
+	}
+	// The events saved so far are queued again by compactEvents under the
+	// new policies
+	if !samePolicies(previous.RetentionPolicies, config.RetentionPolicies) {
+		if err := scheduleReindex(stub); err != nil {
+			logger.Error("Error occured while scheduling retention reindex: ", err)
+			return shim.Error("Failed to store configuration.")
+		}
+	}
 	return shim.Success(nil)
 }
 
+// scheduleReindex stores the first key of savedIndex under reindexIndex, so
+// that compactEvents queues the retention entries of the saved events again.
+// Nothing is scheduled before the first event is saved.
+func scheduleReindex(stub shim.ChaincodeStubInterface) error {
+	startKey, err := rangeKey(stub, savedIndex)
+	if err != nil {
+		return err
+	}
+	resultsIterator, err := stub.GetStateByRange(startKey, startKey+string(utf8.MaxRune))
+	if err != nil {
+		return err
+	}
+	saved := resultsIterator.HasNext()
+	resultsIterator.Close()
+	if !saved {
+		return nil
+	}
+	reindexKey, err := stub.CreateCompositeKey(reindexIndex, []string{})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(reindexKey, []byte(startKey))
+}
+
+// samePolicies reports whether two lists hold the same retention policies in
+// the same order
+func samePolicies(a []retentionPolicy, b []retentionPolicy) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Invoke is called per transaction on the smart contract. Each transaction is
 // either updating the state or retreiving the state created by Init function.
 func (t *SimpleAsset) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
@@ -59,6 +603,32 @@ func (t *SimpleAsset) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 		return t.getKeyDetails(stub, args)
 	} else if function == "getHistoryByKey" {
 		return t.getHistoryByKey(stub, args)
+	} else if function == "getEventsByStream" {
+		return t.getEventsByStream(stub, args)
+	} else if function == "queryEvents" {
+		return t.queryEvents(stub, args)
+	} else if function == "queryEventsBySource" {
+		return t.queryEventsBySource(stub, args)
+	} else if function == "queryEventsByDate" {
+		return t.queryEventsByDate(stub, args)
+	} else if function == "purgeIdempotencyKeys" {
+		return t.purgeIdempotencyKeys(stub, args)
+	} else if function == "compactEvents" {
+		return t.compactEvents(stub, args)
+	} else if function == "anchorEvents" {
+		return t.anchorEvents(stub, args)
+	} else if function == "getEventProof" {
+		return t.getEventProof(stub, args)
+	} else if function == "verifyEventProof" {
+		return t.verifyEventProof(stub, args)
+	} else if function == "subscribe" {
+		return t.subscribe(stub, args)
+	} else if function == "unsubscribe" {
+		return t.unsubscribe(stub, args)
+	} else if function == "ackEvents" {
+		return t.ackEvents(stub, args)
+	} else if function == "getPendingEvents" {
+		return t.getPendingEvents(stub, args)
 	} else if function == "getVersion" {
 		return t.getVersion(stub)
 	}
@@ -72,126 +642,2418 @@ func (t *SimpleAsset) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 func (t *SimpleAsset) getVersion(stub shim.ChaincodeStubInterface) peer.Response {
 	logger.Debug("getVersion called.")
 
-	return shim.Success([]byte("Zapier:1.0.0"))
+	return shim.Success([]byte("Zapier:1.1.0"))
 }
 
 // saveNewEvent stores the event on the ledger. For each key,
-// it will override the current state with the new one
+// it will override the current state with the new one.
+// Keys are namespaced by tenant: events are stored under the composite key
+// tenant~key, the tenant being the one of the caller or the one passed as
+// optional fifth argument.
+// Events are stored as JSON objects: other payloads are wrapped as
+// {"raw": ...}, and the txID, transaction timestamp and MSP id of the creator
+// are stamped under the reserved ~meta field.
+// When a stream name is passed as optional third argument, the event is
+// instead appended to the stream under its own composite key
+// (tenant~stream~key~timestamp~txID), keeping every earlier event of the key.
+// The hash of every saved event is queued to be anchored by anchorEvents.
+// When an idempotency key is passed as optional fourth argument, requests
+// repeating an idempotency key processed within the configured retention
+// return the original result without saving the event again.
+// An event type may be passed as optional sixth argument. It is stamped in
+// the metadata of the event and names the chaincode event emitted for it,
+// such as zapier.<type>; events without type emit the saveNewEvent event.
+// The payload of the chaincode event depends on the configured emit mode.
+// The event is queued for every matching subscription of its tenant.
 func (t *SimpleAsset) saveNewEvent(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	logger.Debug("saveNewEvent() called.")
 
 	// Essential check to verify number of arguments
-	if len(args) != 2 {
+	if len(args) < 2 || len(args) > 6 {
 		logger.Error("Incorrect number of arguments passed in saveNewEvent.")
-		resp := shim.Error("Incorrect number of arguments. Expecting 2 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 2 to 6 arguments: " + strconv.Itoa(len(args)) + " given.")
 		resp.Status = 400
 		return resp
 	}
 	key := args[0]
 	eventAsString := args[1]
 	logger.Debug("eventAsString: ", eventAsString)
+	eventType := ""
+	if len(args) > 5 {
+		eventType = args[5]
+	}
 
-	eventAsBytes := []byte(eventAsString)
 	if key == "" {
 		logger.Error("Empty key passed to saveNewEvent()")
 		resp := shim.Error("Key must not be empty.")
 		resp.Status = 400
 		return resp
+	} else if !isValidEventType(eventType) {
+		logger.Error("Invalid event type passed to saveNewEvent(): ", eventType)
+		resp := shim.Error("Event type must only contain letters, digits, '.', '_' and '-': " + eventType + " given.")
+		resp.Status = 400
+		return resp
 	} else {
-		err := stub.PutState(key, eventAsBytes)
+		txTimestamp, err := stub.GetTxTimestamp()
+		if err != nil {
+			logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+			return shim.Error("Failed to get transaction timestamp.")
+		}
+		timestamp := time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC()
+
+		caller, err := getCaller(stub)
+		if err != nil {
+			logger.Error("Error occured while reading creator identity: ", err)
+			return shim.Error("Failed to get creator identity.")
+		}
+		tenant, resp, ok := resolveTenant(caller, args, 4)
+		if !ok {
+			return resp
+		}
+
+		idempotencyKey := ""
+		var previous *idempotencyRecord
+		if len(args) > 3 && args[3] != "" {
+			idempotencyKey = args[3]
+			previous, err = getIdempotencyRecord(stub, tenant, idempotencyKey)
+			if err != nil {
+				logger.Error("Error occured while reading idempotency key: ", err)
+				return shim.Error("Failed to read idempotency key: " + idempotencyKey)
+			}
+			if previous != nil {
+				expired, err := isExpired(stub, previous, timestamp)
+				if err != nil {
+					logger.Error("Error occured while reading idempotency key: ", err)
+					return shim.Error("Failed to read idempotency key: " + idempotencyKey)
+				}
+				if !expired {
+					logger.Info("Idempotency key already processed : ", idempotencyKey)
+					return shim.Success([]byte(previous.Result))
+				}
+			}
+		}
+
+		event, err := normalizeEvent(eventAsString)
+		if err != nil {
+			logger.Error("Invalid event passed to saveNewEvent(): ", err)
+			resp := shim.Error(err.Error())
+			resp.Status = 400
+			return resp
+		}
+		event[metaField], err = json.Marshal(eventMeta{TxId: stub.GetTxID(), Timestamp: timestamp.Format(eventTimestampFormat), CreatorMSP: caller.MSPID, Tenant: tenant, Type: eventType})
+		if err != nil {
+			logger.Error("Error occured while marshalling event metadata: ", err)
+			return shim.Error("Failed to marshal event.")
+		}
+		eventAsBytes, err := json.Marshal(event)
+		if err != nil {
+			logger.Error("Error occured while marshalling event: ", err)
+			return shim.Error("Failed to marshal event.")
+		}
+
+		var stateKey string
+		if len(args) > 2 && args[2] != "" {
+			stateKey, err = stub.CreateCompositeKey(streamIndex, []string{tenant, args[2], key, timestamp.Format(eventTimestampFormat), stub.GetTxID()})
+		} else {
+			stateKey, err = stub.CreateCompositeKey(tenantIndex, []string{tenant, key})
+		}
+		if err != nil {
+			logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+			resp := shim.Error("Tenant, stream and key must be valid UTF-8 strings.")
+			resp.Status = 400
+			return resp
+		}
+
+		err = stub.PutState(stateKey, eventAsBytes)
+		if err == nil && len(args) > 2 && args[2] != "" {
+			err = putStreamTimeEntry(stub, tenant, args[2], key, timestamp, stub.GetTxID())
+		}
 		if err != nil {
 			logger.Error("Error occured while calling PutState(): ", err)
 			return shim.Error("Error in updating ledger.")
 		}
+		err = putPendingLeaf(stub, pendingLeaf{Tenant: tenant, Key: key, TxId: stub.GetTxID(), Hash: hex.EncodeToString(hashEventLeaf(tenant, key, stub.GetTxID(), eventAsBytes))}, timestamp)
+		if err != nil {
+			logger.Error("Error occured while queuing event hash: ", err)
+			return shim.Error("Error in updating ledger.")
+		}
 
-		err = stub.SetEvent("saveNewEvent", eventAsBytes)
+		stream := ""
+		if len(args) > 2 {
+			stream = args[2]
+		}
+		entry := retentionEntry{Tenant: tenant, Stream: stream, Key: key, TxId: stub.GetTxID(), Timestamp: timestamp.Format(eventTimestampFormat)}
+		err = putSavedEntry(stub, entry)
+		if err == nil {
+			err = putRetentionEntries(stub, entry, eventAsBytes, timestamp)
+		}
+		if err != nil {
+			logger.Error("Error occured while queuing retention entries: ", err)
+			return shim.Error("Error in updating ledger.")
+		}
+		emitted := emittedEvent{Tenant: tenant, Key: key, Stream: stream, Type: eventType, TxId: stub.GetTxID(), Timestamp: timestamp.Format(eventTimestampFormat)}
+		err = emitEvent(stub, emitted, eventAsBytes)
 		if err != nil {
 			logger.Error("Error occured while calling SetEvent(): ", err)
+			return shim.Error("Failed to emit event.")
+		}
+		err = queueEvent(stub, emitted, eventAsBytes)
+		if err != nil {
+			logger.Error("Error occured while queuing event for subscriptions: ", err)
+			return shim.Error("Error in updating ledger.")
 		}
-	}
-	return shim.Success([]byte(key))
-}
 
-// main function starts up the smart contract in the container during instantiate
-func main() {
-	logger.Debug("main() called.")
-	if err := shim.Start(new(SimpleAsset)); err != nil {
-		logger.Error("Error starting SimpleAsset smart contract: ", err)
-		fmt.Printf("Error starting SimpleAsset smart contract: %s", err)
+		if idempotencyKey != "" {
+			record := idempotencyRecord{Result: key, TxId: stub.GetTxID(), Timestamp: timestamp.Format(eventTimestampFormat)}
+			err = putIdempotencyRecord(stub, tenant, idempotencyKey, record, previous)
+			if err != nil {
+				logger.Error("Error occured while storing idempotency key: ", err)
+				return shim.Error("Failed to store idempotency key: " + idempotencyKey)
+			}
+		}
 	}
+	return shim.Success([]byte(key))
 }
 
-// getHistoryByKey queries the ledger using key.
-// It retrieve all the changes to the value happened over time.
-func (t *SimpleAsset) getHistoryByKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	logger.Debug("getHistoryByKey called.")
+// purgeIdempotencyKeys removes the idempotency keys whose retention has
+// passed, oldest first. It takes an optional argument limiting the number of
+// keys removed in one transaction, at most and by default maxPurgeSize.
+func (t *SimpleAsset) purgeIdempotencyKeys(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("purgeIdempotencyKeys called.")
 
 	// Essential check to verify number of arguments
-	if len(args) != 1 {
-		logger.Error("Incorrect number of arguments passed in getHistoryByKey.")
-		resp := shim.Error("Incorrect number of arguments. Expecting 1 arguments: " + strconv.Itoa(len(args)) + " given.")
+	if len(args) > 1 {
+		logger.Error("Incorrect number of arguments passed in purgeIdempotencyKeys.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 0 or 1 arguments: " + strconv.Itoa(len(args)) + " given.")
 		resp.Status = 400
 		return resp
 	}
+	batchSize := maxPurgeSize
+	if len(args) == 1 && args[0] != "" {
+		var err error
+		batchSize, err = strconv.Atoi(args[0])
+		if err != nil || batchSize <= 0 || batchSize > maxPurgeSize {
+			logger.Error("Invalid batch size passed to purgeIdempotencyKeys(): ", args[0])
+			resp := shim.Error("Batch size must be a number between 1 and " + strconv.Itoa(maxPurgeSize) + ": " + args[0] + " given.")
+			resp.Status = 400
+			return resp
+		}
+	}
 
-	key := args[0]
-	resultsIterator, err := stub.GetHistoryForKey(key)
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return shim.Error("Failed to get transaction timestamp.")
+	}
+	now := time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC()
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return shim.Error("Failed to read configuration.")
+	}
+	retention, err := idempotencyRetention(config)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return shim.Error("Failed to read configuration.")
+	}
 
+	result := purgeResult{}
+	if retention == 0 {
+		return purgeResponse(result)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(idempotencyTimeIndex, []string{})
 	if err != nil {
-		logger.Error("Error occured while calling GetHistoryForKey(): ", err)
-		return shim.Error("Error occured while calling GetHistoryForKey: " + err.Error())
+		logger.Error("Error occured while calling GetStateByPartialCompositeKey(): ", err)
+		return shim.Error("Failed to read idempotency keys.")
 	}
 	defer resultsIterator.Close()
-
-	// buffer is a JSON array containing historic values for the event
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
-	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
 		response, err := resultsIterator.Next()
 		if err != nil {
 			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
-			return shim.Error("Error occured while calling GetHistoryByKey (resultsIterator): " + err.Error())
+			return shim.Error("Failed to read idempotency keys.")
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil || len(attributes) != 3 {
+			logger.Error("Error occured while calling SplitCompositeKey(): ", err)
+			return shim.Error("Invalid idempotency key: " + response.Key)
+		}
+		processedAt, err := time.Parse(eventTimestampFormat, attributes[0])
+		if err != nil {
+			logger.Error("Error occured while parsing idempotency key timestamp: ", err)
+			return shim.Error("Invalid idempotency key: " + response.Key)
+		}
+		if now.Before(processedAt.Add(retention)) {
+			break
+		}
+		if result.Purged == batchSize {
+			result.More = true
+			break
 		}
-		buffer.WriteString("{\"TxId\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(response.TxId)
-		buffer.WriteString("\"")
 
-		buffer.WriteString(", \"Value\":")
-		buffer.WriteString(string(response.Value))
+		recordKey, err := stub.CreateCompositeKey(idempotencyIndex, attributes[1:])
+		if err == nil {
+			err = stub.DelState(recordKey)
+		}
+		if err == nil {
+			err = stub.DelState(response.Key)
+		}
+		if err != nil {
+			logger.Error("Error occured while calling DelState(): ", err)
+			return shim.Error("Failed to purge idempotency key: " + attributes[2])
+		}
+		result.Purged++
 	}
-	buffer.WriteString("]")
+	return purgeResponse(result)
+}
 
-	return shim.Success(buffer.Bytes())
+// purgeResponse marshals the result of purgeIdempotencyKeys
+func purgeResponse(result purgeResult) peer.Response {
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling purge result: ", err)
+		return shim.Error("Failed to marshal purge result.")
+	}
+	return shim.Success(resultAsBytes)
 }
 
-// getKeyDetails queries using key.
-// It retrieves the latest state of the value.
-func (t *SimpleAsset) getKeyDetails(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	logger.Debug("getKeyDetails called.")
+// compactEvents removes the events that have expired according to the
+// configured retention policies, in the order in which they expired. Only the
+// retention entries that are due are read, at most maxCompactSize of them, and
+// the policies are checked again before removing an event, so that events
+// are kept if their policy has been relaxed since they were saved. After the
+// policies change, the transactions first queue the retention entries of the
+// events saved before again, as many as the batch size at a time, and remove
+// no events until they are done. Before removing them, it stores a summary of the
+// removed events of each tenant under the composite key
+// compaction~tenant~txID. It takes an optional argument limiting the number
+// of events removed in one transaction, at most and by default
+// maxCompactSize. Only auditors may compact events.
+func (t *SimpleAsset) compactEvents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("compactEvents called.")
 
 	// Essential check to verify number of arguments
-	if len(args) != 1 {
-		logger.Error("Incorrect number of arguments passed in getKeyDetails.")
-		resp := shim.Error("Incorrect number of arguments. Expecting 1 argument: " + strconv.Itoa(len(args)) + " given.")
+	if len(args) > 1 {
+		logger.Error("Incorrect number of arguments passed in compactEvents.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 0 or 1 arguments: " + strconv.Itoa(len(args)) + " given.")
 		resp.Status = 400
 		return resp
 	}
+	batchSize := maxCompactSize
+	if len(args) == 1 && args[0] != "" {
+		var err error
+		batchSize, err = strconv.Atoi(args[0])
+		if err != nil || batchSize <= 0 || batchSize > maxCompactSize {
+			logger.Error("Invalid batch size passed to compactEvents(): ", args[0])
+			resp := shim.Error("Batch size must be a number between 1 and " + strconv.Itoa(maxCompactSize) + ": " + args[0] + " given.")
+			resp.Status = 400
+			return resp
+		}
+	}
 
-	key := args[0]
-	if key == "" {
-		logger.Error("Empty key passed to getKeyDetails()")
-		resp := shim.Error("Key must not be empty.")
-		resp.Status = 400
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return shim.Error("Failed to get creator identity.")
+	}
+	if !caller.Auditor {
+		logger.Info("Access denied to compactEvents for tenant : ", caller.Tenant)
+		resp := shim.Error("Only auditors may compact events.")
+		resp.Status = 403
 		return resp
-	} else {
-		valueAsBytes, err := stub.GetState(key)
+	}
+
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return shim.Error("Failed to get transaction timestamp.")
+	}
+	now := time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC()
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return shim.Error("Failed to read configuration.")
+	}
+
+	result := compactResult{Summaries: []compactionSummary{}}
+	// The retention entries queued again are only read by the next
+	// transactions, so a transaction reindexing events removes none
+	reindexed, reindexing, err := reindexRetention(stub, batchSize)
+	if err != nil {
+		logger.Error("Error occured while reindexing retention entries: ", err)
+		return shim.Error("Failed to reindex events.")
+	}
+	if reindexing {
+		result.Reindexed, result.More = reindexed, true
+		resultAsBytes, err := json.Marshal(result)
+		if err != nil {
+			logger.Error("Error occured while marshalling compaction result: ", err)
+			return shim.Error("Failed to marshal compaction result.")
+		}
+		return shim.Success(resultAsBytes)
+	}
+	expired, more, err := collectExpiredEvents(stub, config.RetentionPolicies, batchSize, now)
+	if err != nil {
+		logger.Error("Error occured while reading retention entries: ", err)
+		return shim.Error("Failed to read events.")
+	}
+	result.More = more
+
+	// Summaries are stored before the events are removed, so that the
+	// removed values stay provable
+	summaries := map[string]int{}
+	leaves := [][][]byte{}
+	for _, event := range expired {
+		i, found := summaries[event.tenant]
+		if !found {
+			i = len(result.Summaries)
+			summaries[event.tenant] = i
+			result.Summaries = append(result.Summaries, compactionSummary{Tenant: event.tenant, TxId: stub.GetTxID(), FirstTimestamp: event.Timestamp, LastTimestamp: event.Timestamp})
+			leaves = append(leaves, nil)
+		}
+		summary := &result.Summaries[i]
+		summary.Count++
+		summary.Events = append(summary.Events, event.archivedEvent)
+		if event.Timestamp < summary.FirstTimestamp {
+			summary.FirstTimestamp = event.Timestamp
+		}
+		if event.Timestamp > summary.LastTimestamp {
+			summary.LastTimestamp = event.Timestamp
+		}
+		leaves[i] = append(leaves[i], event.value)
+	}
+	for i := range result.Summaries {
+		summary := &result.Summaries[i]
+		summary.MerkleRoot = hex.EncodeToString(merkleRoot(leaves[i]))
+		summaryAsBytes, err := json.Marshal(summary)
+		if err != nil {
+			logger.Error("Error occured while marshalling compaction summary: ", err)
+			return shim.Error("Failed to marshal compaction summary.")
+		}
+		summaryKey, err := stub.CreateCompositeKey(compactionIndex, []string{summary.Tenant, summary.TxId})
+		if err == nil {
+			err = stub.PutState(summaryKey, summaryAsBytes)
+		}
+		if err != nil {
+			logger.Error("Error occured while storing compaction summary: ", err)
+			return shim.Error("Failed to store compaction summary.")
+		}
+	}
+	for _, event := range expired {
+		err := stub.DelState(event.stateKey)
+		if err == nil && event.Stream != "" {
+			err = delStreamTimeEntry(stub, event.tenant, event.Stream, event.Key, event.timestamp, event.TxId)
+		}
+		if err == nil && event.Timestamp != "" {
+			var savedKey string
+			savedKey, err = rangeKey(stub, savedIndex, event.Timestamp, event.TxId)
+			if err == nil {
+				err = stub.DelState(savedKey)
+			}
+		}
+		if err != nil {
+			logger.Error("Error occured while calling DelState(): ", err)
+			return shim.Error("Failed to remove event: " + event.Key)
+		}
+		result.Compacted++
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling compaction result: ", err)
+		return shim.Error("Failed to marshal compaction result.")
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// collectExpiredEvents reads the retention entries that are due, oldest
+// first, and returns at most batchSize events that have expired, and whether
+// more may remain. The entries that have been fully processed are removed.
+func collectExpiredEvents(stub shim.ChaincodeStubInterface, policies []retentionPolicy, batchSize int, now time.Time) ([]storedEvent, bool, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(retentionIndex, []string{})
+	if err != nil {
+		return nil, false, err
+	}
+	defer resultsIterator.Close()
+
+	var expired []storedEvent
+	collected := map[string]bool{}
+	// Keys of streams whose events have all been checked
+	checked := map[string]bool{}
+	for read := 0; resultsIterator.HasNext(); read++ {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, false, err
+		}
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil || len(attributes) != 3 {
+			return nil, false, fmt.Errorf("invalid retention entry %q", response.Key)
+		}
+		dueAt, err := time.Parse(eventTimestampFormat, attributes[0])
+		if err != nil {
+			return nil, false, err
+		}
+		if now.Before(dueAt) {
+			break
+		}
+		if read == maxCompactSize {
+			return expired, true, nil
+		}
+		var entry retentionEntry
+		if err := json.Unmarshal(response.Value, &entry); err != nil {
+			return nil, false, err
+		}
+
+		var candidates []storedEvent
+		streamKey := ""
+		switch attributes[2] {
+		case retentionAge:
+			candidates, err = readRetainedEvent(stub, entry)
+			if len(candidates) == 1 && !isEventExpired(policies, candidates[0], 0, now) {
+				candidates = nil
+			}
+		case retentionCount:
+			streamKey, err = stub.CreateCompositeKey(streamIndex, []string{entry.Tenant, entry.Stream, entry.Key})
+			if err == nil && !checked[streamKey] {
+				var events []storedEvent
+				events, err = readStreamKey(stub, entry)
+				for i, event := range events {
+					if isEventExpired(policies, event, len(events)-1-i, now) {
+						candidates = append(candidates, event)
+					}
+				}
+			}
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, event := range candidates {
+			if collected[event.stateKey] {
+				continue
+			}
+			// The entry is kept until all of its events are removed
+			if len(expired) == batchSize {
+				return expired, true, nil
+			}
+			expired = append(expired, event)
+			collected[event.stateKey] = true
+		}
+		if streamKey != "" {
+			checked[streamKey] = true
+		}
+		if err := stub.DelState(response.Key); err != nil {
+			return nil, false, err
+		}
+	}
+	return expired, false, nil
+}
+
+// readRetainedEvent reads the event identified by a retention entry. No
+// event is returned if it has been removed or, for events stored under the
+// key of the tenant, overwritten since.
+func readRetainedEvent(stub shim.ChaincodeStubInterface, entry retentionEntry) ([]storedEvent, error) {
+	var stateKey string
+	var err error
+	if entry.Stream != "" {
+		stateKey, err = stub.CreateCompositeKey(streamIndex, []string{entry.Tenant, entry.Stream, entry.Key, entry.Timestamp, entry.TxId})
+	} else {
+		stateKey, err = stub.CreateCompositeKey(tenantIndex, []string{entry.Tenant, entry.Key})
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, err := stub.GetState(stateKey)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	event, err := parseStoredEvent(stub, stateKey, value)
+	if err != nil || event.TxId != entry.TxId {
+		return nil, err
+	}
+	return []storedEvent{event}, nil
+}
+
+// readStreamKey reads the events of the key of a stream named by a retention
+// entry, oldest first
+func readStreamKey(stub shim.ChaincodeStubInterface, entry retentionEntry) ([]storedEvent, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(streamIndex, []string{entry.Tenant, entry.Stream, entry.Key})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var events []storedEvent
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		event, err := parseStoredEvent(stub, response.Key, response.Value)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// putRetentionEntries queues the retention entries of a saved event,
+// according to the first configured retention policy matching it
+func putRetentionEntries(stub shim.ChaincodeStubInterface, entry retentionEntry, value []byte, timestamp time.Time) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	policy := eventPolicy(config.RetentionPolicies, entry.Key, value)
+	if policy == nil {
+		return nil
+	}
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	putEntry := func(dueAt time.Time, kind string) error {
+		entryKey, err := stub.CreateCompositeKey(retentionIndex, []string{dueAt.Format(eventTimestampFormat), entry.TxId, kind})
+		if err != nil {
+			return err
+		}
+		return stub.PutState(entryKey, entryAsBytes)
+	}
+	// Events stored under the key of the tenant overwrite each other, so
+	// only the events of streams are counted
+	if policy.MaxEvents > 0 && entry.Stream != "" {
+		if err := putEntry(timestamp, retentionCount); err != nil {
+			return err
+		}
+	}
+	if policy.MaxDays > 0 {
+		return putEntry(timestamp.AddDate(0, 0, policy.MaxDays), retentionAge)
+	}
+	return nil
+}
+
+// putSavedEntry lists an event saved by saveNewEvent in savedIndex
+func putSavedEntry(stub shim.ChaincodeStubInterface, entry retentionEntry) error {
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	entryKey, err := rangeKey(stub, savedIndex, entry.Timestamp, entry.TxId)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(entryKey, entryAsBytes)
+}
+
+// reindexRetention queues the retention entries of the events listed in
+// savedIndex again under the current policies, starting from the key stored
+// under reindexIndex. It reads at most limit entries and returns the number
+// of events queued again, and whether a reindex was in progress. Entries of
+// events that have been removed or overwritten are removed from savedIndex.
+func reindexRetention(stub shim.ChaincodeStubInterface, limit int) (int, bool, error) {
+	reindexKey, err := stub.CreateCompositeKey(reindexIndex, []string{})
+	if err != nil {
+		return 0, false, err
+	}
+	startKey, err := stub.GetState(reindexKey)
+	if err != nil || startKey == nil {
+		return 0, false, err
+	}
+	endKey, err := rangeKey(stub, savedIndex)
+	if err != nil {
+		return 0, true, err
+	}
+	resultsIterator, err := stub.GetStateByRange(string(startKey), endKey+string(utf8.MaxRune))
+	if err != nil {
+		return 0, true, err
+	}
+	defer resultsIterator.Close()
+
+	reindexed := 0
+	for read := 0; resultsIterator.HasNext(); read++ {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return reindexed, true, err
+		}
+		if read == limit {
+			return reindexed, true, stub.PutState(reindexKey, []byte(response.Key))
+		}
+		var entry retentionEntry
+		if err := json.Unmarshal(response.Value, &entry); err != nil {
+			return reindexed, true, err
+		}
+		events, err := readRetainedEvent(stub, entry)
+		if err != nil {
+			return reindexed, true, err
+		}
+		if len(events) == 0 {
+			if err := stub.DelState(response.Key); err != nil {
+				return reindexed, true, err
+			}
+			continue
+		}
+		timestamp, err := time.Parse(eventTimestampFormat, entry.Timestamp)
+		if err != nil {
+			return reindexed, true, err
+		}
+		if err := putRetentionEntries(stub, entry, events[0].value, timestamp); err != nil {
+			return reindexed, true, err
+		}
+		reindexed++
+	}
+	return reindexed, true, stub.DelState(reindexKey)
+}
+
+// parseStoredEvent reads the tenant, stream, key, txID and timestamp of an
+// event from its composite key and, for events stored under the key of the
+// tenant, from its metadata. The timestamp is zero if the event has none.
+func parseStoredEvent(stub shim.ChaincodeStubInterface, stateKey string, value []byte) (storedEvent, error) {
+	event := storedEvent{stateKey: stateKey, value: value}
+	objectType, attributes, err := stub.SplitCompositeKey(stateKey)
+	if err != nil {
+		return event, err
+	}
+	if objectType == streamIndex && len(attributes) == 5 {
+		event.tenant, event.Stream, event.Key, event.TxId = attributes[0], attributes[1], attributes[2], attributes[4]
+		event.timestamp, err = time.Parse(eventTimestampFormat, attributes[3])
+		if err != nil {
+			return event, err
+		}
+	} else if objectType == tenantIndex && len(attributes) == 2 {
+		event.tenant, event.Key = attributes[0], attributes[1]
+		var stored struct {
+			Meta eventMeta `json:"~meta"`
+		}
+		if json.Unmarshal(value, &stored) == nil {
+			event.TxId = stored.Meta.TxId
+			event.timestamp, _ = time.Parse(eventTimestampFormat, stored.Meta.Timestamp)
+		}
+	} else {
+		return event, fmt.Errorf("invalid event key %q", stateKey)
+	}
+	if !event.timestamp.IsZero() {
+		event.Timestamp = event.timestamp.Format(eventTimestampFormat)
+	}
+	return event, nil
+}
+
+// isEventExpired reports whether the first retention policy matching an
+// event expires it, newer being the number of newer events of its key
+func isEventExpired(policies []retentionPolicy, event storedEvent, newer int, now time.Time) bool {
+	policy := eventPolicy(policies, event.Key, event.value)
+	if policy == nil {
+		return false
+	}
+	if policy.MaxEvents > 0 && newer >= policy.MaxEvents {
+		return true
+	}
+	return policy.MaxDays > 0 && !event.timestamp.IsZero() && !now.Before(event.timestamp.AddDate(0, 0, policy.MaxDays))
+}
+
+// eventPolicy returns the first retention policy matching the stored value
+// of an event saved under key, or nil. The type of an event is the one
+// passed to saveNewEvent, or else its docType.
+func eventPolicy(policies []retentionPolicy, key string, value []byte) *retentionPolicy {
+	var source struct {
+		DocType string    `json:"docType"`
+		Meta    eventMeta `json:"~meta"`
+	}
+	// Events that are not JSON objects have no type
+	json.Unmarshal(value, &source)
+	eventType := source.Meta.Type
+	if eventType == "" {
+		eventType = source.DocType
+	}
+	for i, policy := range policies {
+		if strings.HasPrefix(key, policy.KeyPrefix) && (policy.EventType == "" || policy.EventType == eventType) {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+// emitEvent sets the chaincode event of a saved event, named after its type
+// and holding the stored event, its hash or only its metadata depending on
+// the configured emit mode
+func emitEvent(stub shim.ChaincodeStubInterface, emitted emittedEvent, eventAsBytes []byte) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	name := defaultEventName
+	if emitted.Type != "" {
+		name = *config.EventNamePrefix + emitted.Type
+	}
+	payload := eventAsBytes
+	if config.EventEmit == emitHash || config.EventEmit == emitMetadata {
+		if config.EventEmit == emitHash {
+			hash := sha256.Sum256(eventAsBytes)
+			emitted.Hash = hex.EncodeToString(hash[:])
+		}
+		payload, err = json.Marshal(emitted)
+		if err != nil {
+			return err
+		}
+	}
+	return stub.SetEvent(name, payload)
+}
+
+// isValidEventType reports whether an event type only holds characters that
+// listeners can safely filter on
+func isValidEventType(eventType string) bool {
+	for _, c := range eventType {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// queueEvent queues a saved event for the subscriptions of its tenant
+// matching its type
+func queueEvent(stub shim.ChaincodeStubInterface, emitted emittedEvent, eventAsBytes []byte) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(subscriptionIndex, []string{emitted.Tenant})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	var entryAsBytes []byte
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var registered subscription
+		if err := json.Unmarshal(response.Value, &registered); err != nil {
+			return err
+		}
+		if !matchesEventType(registered.EventType, emitted.Type) {
+			continue
+		}
+		if entryAsBytes == nil {
+			entryAsBytes, err = json.Marshal(pendingEvent{emittedEvent: emitted, Value: eventValue(eventAsBytes)})
+			if err != nil {
+				return err
+			}
+		}
+		entryKey, err := stub.CreateCompositeKey(queueIndex, []string{registered.Tenant, registered.Id, emitted.Timestamp, emitted.TxId})
+		if err != nil {
+			return err
+		}
+		if err := stub.PutState(entryKey, entryAsBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesEventType reports whether an event type matches the filter of a
+// subscription
+func matchesEventType(filter string, eventType string) bool {
+	if strings.HasSuffix(filter, "*") {
+		return strings.HasPrefix(eventType, strings.TrimSuffix(filter, "*"))
+	}
+	return filter == "" || filter == eventType
+}
+
+// subscribe registers a subscription to the events of a tenant. It expects
+// an event type filter, which may be empty to match every event or end with
+// "*" to match the types starting with the preceding characters, the
+// identifier of the delivery target and optionally the tenant, by default
+// the tenant of the caller. It returns the subscription, whose id is the
+// txID of the transaction. Only events saved after the subscription are
+// queued for it.
+func (t *SimpleAsset) subscribe(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("subscribe called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 2 || len(args) > 3 {
+		logger.Error("Incorrect number of arguments passed in subscribe.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 2 or 3 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	eventType, target := args[0], args[1]
+	if !isValidEventType(strings.TrimSuffix(eventType, "*")) {
+		logger.Error("Invalid event type passed to subscribe(): ", eventType)
+		resp := shim.Error("Event type must only contain letters, digits, '.', '_' and '-', optionally followed by '*': " + eventType + " given.")
+		resp.Status = 400
+		return resp
+	}
+	if target == "" {
+		logger.Error("Empty target passed to subscribe()")
+		resp := shim.Error("Target must not be empty.")
+		resp.Status = 400
+		return resp
+	}
+
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return shim.Error("Failed to get transaction timestamp.")
+	}
+	timestamp := time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC()
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return shim.Error("Failed to get creator identity.")
+	}
+	tenant, resp, ok := resolveTenant(caller, args, 2)
+	if !ok {
+		return resp
+	}
+
+	registered := subscription{Id: stub.GetTxID(), Tenant: tenant, EventType: eventType, Target: target, Timestamp: timestamp.Format(eventTimestampFormat)}
+	subscriptionAsBytes, err := json.Marshal(registered)
+	if err != nil {
+		logger.Error("Error occured while marshalling subscription: ", err)
+		return shim.Error("Failed to marshal subscription.")
+	}
+	subscriptionKey, err := stub.CreateCompositeKey(subscriptionIndex, []string{tenant, registered.Id})
+	if err == nil {
+		err = stub.PutState(subscriptionKey, subscriptionAsBytes)
+	}
+	if err != nil {
+		logger.Error("Error occured while storing subscription: ", err)
+		return shim.Error("Failed to store subscription.")
+	}
+	return shim.Success(subscriptionAsBytes)
+}
+
+// unsubscribe removes a subscription and its acknowledgement, and up to
+// maxPendingSize of its queued events. It expects the subscription id and
+// optionally its tenant, by default the tenant of the caller. When queued
+// events remain, the removal is recorded under unsubscribedIndex and it
+// should be invoked again to remove them.
+func (t *SimpleAsset) unsubscribe(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("unsubscribe called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 2 {
+		logger.Error("Incorrect number of arguments passed in unsubscribe.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 or 2 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	subscriptionId := args[0]
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return shim.Error("Failed to get creator identity.")
+	}
+	tenant, resp, ok := resolveTenant(caller, args, 1)
+	if !ok {
+		return resp
+	}
+	unsubscribedKey, err := stub.CreateCompositeKey(unsubscribedIndex, []string{tenant, subscriptionId})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		resp := shim.Error("Tenant and subscription id must be valid UTF-8 strings.")
+		resp.Status = 400
+		return resp
+	}
+	subscriptionKey, _, resp, ok := getSubscription(stub, args, 1)
+	if !ok {
+		// A previous call may have removed the subscription of the tenant
+		// but left queued events to remove
+		if resp.Status != 400 {
+			return resp
+		}
+		unsubscribed, err := stub.GetState(unsubscribedKey)
+		if err != nil {
+			logger.Error("Error occured while calling GetState(): ", err)
+			return shim.Error("Failed to get subscription: " + subscriptionId)
+		}
+		if unsubscribed == nil {
+			return resp
+		}
+	} else {
+		ackKey, err := stub.CreateCompositeKey(ackIndex, []string{tenant, subscriptionId})
+		if err == nil {
+			err = stub.DelState(ackKey)
+		}
+		if err == nil {
+			err = stub.DelState(subscriptionKey)
+		}
+		if err != nil {
+			logger.Error("Error occured while calling DelState(): ", err)
+			return shim.Error("Failed to remove subscription: " + subscriptionId)
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(queueIndex, []string{tenant, subscriptionId})
+	if err != nil {
+		logger.Error("Error occured while calling GetStateByPartialCompositeKey(): ", err)
+		return shim.Error("Failed to read queued events.")
+	}
+	defer resultsIterator.Close()
+	result := ackResult{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return shim.Error("Failed to read queued events.")
+		}
+		if result.Removed == maxPendingSize {
+			result.More = true
+			break
+		}
+		if err := stub.DelState(response.Key); err != nil {
+			logger.Error("Error occured while calling DelState(): ", err)
+			return shim.Error("Failed to remove queued event: " + response.Key)
+		}
+		result.Removed++
+	}
+	if result.More {
+		err = stub.PutState(unsubscribedKey, []byte{0x00})
+	} else {
+		err = stub.DelState(unsubscribedKey)
+	}
+	if err != nil {
+		logger.Error("Error occured while recording removed subscription: ", err)
+		return shim.Error("Failed to remove subscription: " + subscriptionId)
+	}
+	return ackResponse(result)
+}
+
+// ackEvents acknowledges the delivery of the events queued for a
+// subscription, up to and including the event saved by a transaction. The
+// acknowledged events are removed from the queue and the transaction is
+// recorded as the last acknowledged one. Acknowledging the last
+// acknowledged transaction again has no effect. The tenant of the
+// subscription may be passed as optional third argument.
+func (t *SimpleAsset) ackEvents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("ackEvents called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 2 || len(args) > 3 {
+		logger.Error("Incorrect number of arguments passed in ackEvents.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 2 or 3 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	subscriptionId, txId := args[0], args[1]
+	_, registered, resp, ok := getSubscription(stub, args, 2)
+	if !ok {
+		return resp
+	}
+	ackKey, err := stub.CreateCompositeKey(ackIndex, []string{registered.Tenant, subscriptionId})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		return shim.Error("Failed to read acknowledgement.")
+	}
+	lastAcked, err := getAckRecord(stub, ackKey)
+	if err != nil {
+		logger.Error("Error occured while reading acknowledgement: ", err)
+		return shim.Error("Failed to read acknowledgement.")
+	}
+	if lastAcked != nil && lastAcked.TxId == txId {
+		return ackResponse(ackResult{})
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(queueIndex, []string{registered.Tenant, subscriptionId})
+	if err != nil {
+		logger.Error("Error occured while calling GetStateByPartialCompositeKey(): ", err)
+		return shim.Error("Failed to read queued events.")
+	}
+	defer resultsIterator.Close()
+	var acked *ackRecord
+	var queuedKeys []string
+	for acked == nil && resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return shim.Error("Failed to read queued events.")
+		}
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil || len(attributes) != 4 {
+			logger.Error("Error occured while calling SplitCompositeKey(): ", err)
+			return shim.Error("Invalid queued event: " + response.Key)
+		}
+		queuedKeys = append(queuedKeys, response.Key)
+		if attributes[3] == txId {
+			acked = &ackRecord{TxId: txId, Timestamp: attributes[2]}
+		}
+	}
+	if acked == nil {
+		logger.Info("Event not pending for subscription : ", txId)
+		resp := shim.Error("No pending event received for subscription " + subscriptionId + " and txID " + txId + ".")
+		resp.Status = 400
+		return resp
+	}
+
+	for _, queuedKey := range queuedKeys {
+		if err := stub.DelState(queuedKey); err != nil {
+			logger.Error("Error occured while calling DelState(): ", err)
+			return shim.Error("Failed to remove queued event: " + queuedKey)
+		}
+	}
+	ackAsBytes, err := json.Marshal(acked)
+	if err == nil {
+		err = stub.PutState(ackKey, ackAsBytes)
+	}
+	if err != nil {
+		logger.Error("Error occured while storing acknowledgement: ", err)
+		return shim.Error("Failed to store acknowledgement.")
+	}
+	return ackResponse(ackResult{Removed: len(queuedKeys)})
+}
+
+// getPendingEvents lists the events queued for a subscription that have not
+// been acknowledged yet, oldest first, together with the subscription and
+// its last acknowledged event. It takes an optional argument limiting the
+// number of events returned, at most and by default maxPendingSize, and
+// optionally the tenant of the subscription.
+func (t *SimpleAsset) getPendingEvents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getPendingEvents called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 3 {
+		logger.Error("Incorrect number of arguments passed in getPendingEvents.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 to 3 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	limit := maxPendingSize
+	if len(args) > 1 && args[1] != "" {
+		var err error
+		limit, err = strconv.Atoi(args[1])
+		if err != nil || limit <= 0 || limit > maxPendingSize {
+			logger.Error("Invalid limit passed to getPendingEvents(): ", args[1])
+			resp := shim.Error("Limit must be a number between 1 and " + strconv.Itoa(maxPendingSize) + ": " + args[1] + " given.")
+			resp.Status = 400
+			return resp
+		}
+	}
+	subscriptionId := args[0]
+	_, registered, resp, ok := getSubscription(stub, args, 2)
+	if !ok {
+		return resp
+	}
+
+	result := pendingPage{Subscription: registered, Events: []pendingEvent{}}
+	ackKey, err := stub.CreateCompositeKey(ackIndex, []string{registered.Tenant, subscriptionId})
+	if err == nil {
+		result.LastAcked, err = getAckRecord(stub, ackKey)
+	}
+	if err != nil {
+		logger.Error("Error occured while reading acknowledgement: ", err)
+		return shim.Error("Failed to read acknowledgement.")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(queueIndex, []string{registered.Tenant, subscriptionId})
+	if err != nil {
+		logger.Error("Error occured while calling GetStateByPartialCompositeKey(): ", err)
+		return shim.Error("Failed to read queued events.")
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return shim.Error("Failed to read queued events.")
+		}
+		if len(result.Events) == limit {
+			result.More = true
+			break
+		}
+		var event pendingEvent
+		if err := json.Unmarshal(response.Value, &event); err != nil {
+			logger.Error("Error occured while parsing queued event: ", err)
+			return shim.Error("Invalid queued event: " + response.Key)
+		}
+		result.Events = append(result.Events, event)
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling pending events: ", err)
+		return shim.Error("Failed to marshal pending events.")
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// getSubscription reads the subscription whose id is args[0], in the tenant
+// resolved from the caller and args[index], and returns it with its state
+// key, or a 400 response if it does not exist
+func getSubscription(stub shim.ChaincodeStubInterface, args []string, index int) (string, subscription, peer.Response, bool) {
+	var registered subscription
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return "", registered, shim.Error("Failed to get creator identity."), false
+	}
+	tenant, resp, ok := resolveTenant(caller, args, index)
+	if !ok {
+		return "", registered, resp, false
+	}
+	subscriptionId := args[0]
+	subscriptionKey, err := stub.CreateCompositeKey(subscriptionIndex, []string{tenant, subscriptionId})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		resp := shim.Error("Tenant and subscription id must be valid UTF-8 strings.")
+		resp.Status = 400
+		return "", registered, resp, false
+	}
+	subscriptionAsBytes, err := stub.GetState(subscriptionKey)
+	if err != nil {
+		logger.Error("Error occured while calling GetState(): ", err)
+		return "", registered, shim.Error("Failed to get subscription: " + subscriptionId), false
+	}
+	if subscriptionAsBytes == nil {
+		logger.Info("No subscription received for id : ", subscriptionId)
+		resp := shim.Error("No subscription received for id: " + subscriptionId)
+		resp.Status = 400
+		return "", registered, resp, false
+	}
+	if err := json.Unmarshal(subscriptionAsBytes, &registered); err != nil {
+		logger.Error("Error occured while parsing subscription: ", err)
+		return "", registered, shim.Error("Failed to get subscription: " + subscriptionId), false
+	}
+	return subscriptionKey, registered, peer.Response{}, true
+}
+
+// getAckRecord reads the last acknowledged event of a subscription, or
+// returns nil if none was acknowledged yet
+func getAckRecord(stub shim.ChaincodeStubInterface, ackKey string) (*ackRecord, error) {
+	ackAsBytes, err := stub.GetState(ackKey)
+	if err != nil || ackAsBytes == nil {
+		return nil, err
+	}
+	record := &ackRecord{}
+	err = json.Unmarshal(ackAsBytes, record)
+	return record, err
+}
+
+// ackResponse marshals the result of ackEvents and unsubscribe
+func ackResponse(result ackResult) peer.Response {
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling result: ", err)
+		return shim.Error("Failed to marshal result.")
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// putPendingLeaf queues the hash of a saved event to be anchored. Each event
+// is queued under its own key, so that concurrent transactions saving events
+// do not conflict.
+func putPendingLeaf(stub shim.ChaincodeStubInterface, leaf pendingLeaf, timestamp time.Time) error {
+	leafAsBytes, err := json.Marshal(leaf)
+	if err != nil {
+		return err
+	}
+	leafKey, err := stub.CreateCompositeKey(pendingIndex, []string{timestamp.Format(eventTimestampFormat), leaf.TxId})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(leafKey, leafAsBytes)
+}
+
+// anchorEvents anchors the hashes of the events saved since the previous
+// call, oldest first, in a new batch chained to the previous one. It is
+// meant to be invoked periodically and takes an optional argument limiting
+// the size of the batch, at most and by default maxAnchorSize.
+func (t *SimpleAsset) anchorEvents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("anchorEvents called.")
+
+	// Essential check to verify number of arguments
+	if len(args) > 1 {
+		logger.Error("Incorrect number of arguments passed in anchorEvents.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 0 or 1 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	batchSize := maxAnchorSize
+	if len(args) == 1 && args[0] != "" {
+		var err error
+		batchSize, err = strconv.Atoi(args[0])
+		if err != nil || batchSize <= 0 || batchSize > maxAnchorSize {
+			logger.Error("Invalid batch size passed to anchorEvents(): ", args[0])
+			resp := shim.Error("Batch size must be a number between 1 and " + strconv.Itoa(maxAnchorSize) + ": " + args[0] + " given.")
+			resp.Status = 400
+			return resp
+		}
+	}
+
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		logger.Error("Error occured while calling GetTxTimestamp(): ", err)
+		return shim.Error("Failed to get transaction timestamp.")
+	}
+	timestamp := time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC()
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(pendingIndex, []string{})
+	if err != nil {
+		logger.Error("Error occured while calling GetStateByPartialCompositeKey(): ", err)
+		return shim.Error("Failed to read pending events.")
+	}
+	defer resultsIterator.Close()
+	result := anchorResult{}
+	var pendingKeys []string
+	var leaves []pendingLeaf
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return shim.Error("Failed to read pending events.")
+		}
+		if len(leaves) == batchSize {
+			result.More = true
+			break
+		}
+		var leaf pendingLeaf
+		if err := json.Unmarshal(response.Value, &leaf); err != nil {
+			logger.Error("Error occured while parsing pending event: ", err)
+			return shim.Error("Invalid pending event: " + response.Key)
+		}
+		pendingKeys = append(pendingKeys, response.Key)
+		leaves = append(leaves, leaf)
+	}
+	if len(leaves) == 0 {
+		return anchorResponse(result)
+	}
+
+	previous, err := getLatestBatch(stub)
+	if err != nil {
+		logger.Error("Error occured while reading latest batch: ", err)
+		return shim.Error("Failed to read latest batch.")
+	}
+	batch := anchorBatch{Number: 1, TxId: stub.GetTxID(), Timestamp: timestamp.Format(eventTimestampFormat), Leaves: make([]string, len(leaves))}
+	if previous != nil {
+		batch.Number = previous.Number + 1
+		batch.PreviousRoot = previous.Root
+	}
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		batch.Leaves[i] = leaf.Hash
+		hashes[i], err = hex.DecodeString(leaf.Hash)
+		if err != nil {
+			logger.Error("Error occured while parsing pending event: ", err)
+			return shim.Error("Invalid pending event: " + pendingKeys[i])
+		}
+	}
+	treeRoot := merkleRootOfHashes(hashes)
+	batch.TreeRoot = hex.EncodeToString(treeRoot)
+	previousRoot, err := hex.DecodeString(batch.PreviousRoot)
+	if err != nil {
+		logger.Error("Error occured while parsing latest batch: ", err)
+		return shim.Error("Failed to read latest batch.")
+	}
+	batch.Root = hex.EncodeToString(hashBatchRoot(previousRoot, treeRoot))
+	if err := putBatch(stub, batch); err != nil {
+		logger.Error("Error occured while storing batch: ", err)
+		return shim.Error("Failed to store batch.")
+	}
+
+	for i, leaf := range leaves {
+		recordAsBytes, err := json.Marshal(proofRecord{Batch: batch.Number, Index: i})
+		if err != nil {
+			logger.Error("Error occured while marshalling proof record: ", err)
+			return shim.Error("Failed to marshal proof record.")
+		}
+		recordKey, err := stub.CreateCompositeKey(proofIndex, []string{leaf.Tenant, leaf.Key, leaf.TxId})
+		if err == nil {
+			err = stub.PutState(recordKey, recordAsBytes)
+		}
+		if err == nil {
+			err = stub.DelState(pendingKeys[i])
+		}
+		if err != nil {
+			logger.Error("Error occured while storing proof record: ", err)
+			return shim.Error("Failed to anchor event: " + leaf.Key)
+		}
+	}
+	result.Anchored = len(leaves)
+	result.Batch = batch.Number
+	result.Root = batch.Root
+	return anchorResponse(result)
+}
+
+// anchorResponse marshals the result of anchorEvents
+func anchorResponse(result anchorResult) peer.Response {
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling anchor result: ", err)
+		return shim.Error("Failed to marshal anchor result.")
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// getEventProof returns the inclusion proof of the event saved under a key
+// by a transaction, in the namespace of the tenant of the caller or of the
+// tenant passed as optional third argument. The event must have been
+// anchored by anchorEvents.
+func (t *SimpleAsset) getEventProof(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getEventProof called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 2 || len(args) > 3 {
+		logger.Error("Incorrect number of arguments passed in getEventProof.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 2 or 3 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	key, txId := args[0], args[1]
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return shim.Error("Failed to get creator identity.")
+	}
+	tenant, resp, ok := resolveTenant(caller, args, 2)
+	if !ok {
+		return resp
+	}
+	recordKey, err := stub.CreateCompositeKey(proofIndex, []string{tenant, key, txId})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		resp := shim.Error("Tenant, key and txID must be valid UTF-8 strings.")
+		resp.Status = 400
+		return resp
+	}
+	recordAsBytes, err := stub.GetState(recordKey)
+	if err != nil {
+		logger.Error("Error occured while calling GetState(): ", err)
+		return shim.Error("Failed to get proof of event: " + key)
+	}
+	if recordAsBytes == nil {
+		logger.Info("No anchored event received for key : ", key)
+		resp := shim.Error("No anchored event received for key " + key + " and txID " + txId + ".")
+		resp.Status = 400
+		return resp
+	}
+	var record proofRecord
+	if err := json.Unmarshal(recordAsBytes, &record); err != nil {
+		logger.Error("Error occured while parsing proof record: ", err)
+		return shim.Error("Failed to get proof of event: " + key)
+	}
+	batch, err := getBatch(stub, record.Batch)
+	if err != nil || batch == nil || record.Index >= len(batch.Leaves) {
+		logger.Error("Error occured while reading batch: ", err)
+		return shim.Error("Failed to read batch: " + strconv.Itoa(record.Batch))
+	}
+
+	hashes := make([][]byte, len(batch.Leaves))
+	for i, leaf := range batch.Leaves {
+		hashes[i], err = hex.DecodeString(leaf)
+		if err != nil {
+			logger.Error("Error occured while parsing batch: ", err)
+			return shim.Error("Failed to read batch: " + strconv.Itoa(record.Batch))
+		}
+	}
+	proof := eventProof{
+		Tenant:       tenant,
+		Key:          key,
+		TxId:         txId,
+		Leaf:         batch.Leaves[record.Index],
+		Batch:        batch.Number,
+		Root:         batch.Root,
+		TreeRoot:     batch.TreeRoot,
+		PreviousRoot: batch.PreviousRoot,
+		Path:         merkleProof(hashes, record.Index),
+	}
+	proofAsBytes, err := json.Marshal(proof)
+	if err != nil {
+		logger.Error("Error occured while marshalling proof: ", err)
+		return shim.Error("Failed to marshal proof of event: " + key)
+	}
+	return shim.Success(proofAsBytes)
+}
+
+// verifyEventProof checks that an event, passed exactly as stored, was saved
+// under the key of a proof returned by getEventProof by its transaction, and
+// is included in its batch. The leaf is computed from the tenant, key and
+// txID of the proof and the event, and the root computed from the leaf, the
+// path of the proof and the root of the previous batch is compared with the
+// root of the batch as anchored on the ledger. The proof record of the key
+// and txID must also name the batch.
+func (t *SimpleAsset) verifyEventProof(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("verifyEventProof called.")
+
+	// Essential check to verify number of arguments
+	if len(args) != 2 {
+		logger.Error("Incorrect number of arguments passed in verifyEventProof.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 2 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+	var proof eventProof
+	if err := json.Unmarshal([]byte(args[1]), &proof); err != nil {
+		logger.Error("Invalid proof passed to verifyEventProof(): ", err)
+		resp := shim.Error("Proof must be a JSON object returned by getEventProof: " + err.Error())
+		resp.Status = 400
+		return resp
+	}
+	batch, err := getBatch(stub, proof.Batch)
+	if err != nil {
+		logger.Error("Error occured while reading batch: ", err)
+		return shim.Error("Failed to read batch: " + strconv.Itoa(proof.Batch))
+	}
+	if batch == nil {
+		logger.Info("No batch received for number : ", proof.Batch)
+		resp := shim.Error("No batch received for number: " + strconv.Itoa(proof.Batch))
+		resp.Status = 400
+		return resp
+	}
+
+	recordKey, err := stub.CreateCompositeKey(proofIndex, []string{proof.Tenant, proof.Key, proof.TxId})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		resp := shim.Error("Tenant, key and txID must be valid UTF-8 strings.")
+		resp.Status = 400
+		return resp
+	}
+	recordAsBytes, err := stub.GetState(recordKey)
+	if err != nil {
+		logger.Error("Error occured while calling GetState(): ", err)
+		return shim.Error("Failed to get proof of event: " + proof.Key)
+	}
+
+	result := verifyResult{Key: proof.Key, TxId: proof.TxId, Batch: batch.Number, Root: batch.Root}
+	var record proofRecord
+	result.Valid = recordAsBytes != nil && json.Unmarshal(recordAsBytes, &record) == nil && record.Batch == batch.Number
+	root := hashEventLeaf(proof.Tenant, proof.Key, proof.TxId, []byte(args[0]))
+	for _, step := range proof.Path {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			result.Valid = false
+			break
+		}
+		if step.Left {
+			root = hashNodes(sibling, root)
+		} else {
+			root = hashNodes(root, sibling)
+		}
+	}
+	previousRoot, err := hex.DecodeString(batch.PreviousRoot)
+	result.Valid = result.Valid && err == nil && hex.EncodeToString(hashBatchRoot(previousRoot, root)) == batch.Root
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling verification result: ", err)
+		return shim.Error("Failed to marshal verification result.")
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// getBatch reads an anchored batch, or returns nil if it does not exist
+func getBatch(stub shim.ChaincodeStubInterface, number int) (*anchorBatch, error) {
+	batchKey, err := stub.CreateCompositeKey(batchIndex, []string{strconv.Itoa(number)})
+	if err != nil {
+		return nil, err
+	}
+	batchAsBytes, err := stub.GetState(batchKey)
+	if err != nil || batchAsBytes == nil {
+		return nil, err
+	}
+	batch := &anchorBatch{}
+	err = json.Unmarshal(batchAsBytes, batch)
+	return batch, err
+}
+
+// getLatestBatch reads the latest anchored batch, or returns nil if no event
+// was anchored yet
+func getLatestBatch(stub shim.ChaincodeStubInterface) (*anchorBatch, error) {
+	latestKey, err := stub.CreateCompositeKey(latestBatchIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	numberAsBytes, err := stub.GetState(latestKey)
+	if err != nil || numberAsBytes == nil {
+		return nil, err
+	}
+	number, err := strconv.Atoi(string(numberAsBytes))
+	if err != nil {
+		return nil, err
+	}
+	return getBatch(stub, number)
+}
+
+// putBatch stores an anchored batch and makes it the latest one
+func putBatch(stub shim.ChaincodeStubInterface, batch anchorBatch) error {
+	batchAsBytes, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	batchKey, err := stub.CreateCompositeKey(batchIndex, []string{strconv.Itoa(batch.Number)})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(batchKey, batchAsBytes)
+	if err != nil {
+		return err
+	}
+	latestKey, err := stub.CreateCompositeKey(latestBatchIndex, []string{})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(latestKey, []byte(strconv.Itoa(batch.Number)))
+}
+
+// merkleRoot returns the root of the Merkle tree of values. Leaves and
+// inner nodes are hashed with SHA-256 under distinct prefixes, and the last
+// node of a level with an odd number of nodes is promoted to the next level.
+func merkleRoot(values [][]byte) []byte {
+	leaves := make([][]byte, len(values))
+	for i, value := range values {
+		leaves[i] = hashLeaf(value)
+	}
+	return merkleRootOfHashes(leaves)
+}
+
+// merkleRootOfHashes returns the root of the Merkle tree of leaf hashes
+func merkleRootOfHashes(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return nil
+	}
+	level := leaves
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+	return level[0]
+}
+
+// merkleProof returns the siblings on the path from a leaf to the root of
+// the Merkle tree of leaf hashes. Levels where the node is promoted have no
+// sibling.
+func merkleProof(leaves [][]byte, index int) []proofStep {
+	path := []proofStep{}
+	level := leaves
+	for len(level) > 1 {
+		if index%2 == 1 {
+			path = append(path, proofStep{Hash: hex.EncodeToString(level[index-1]), Left: true})
+		} else if index+1 < len(level) {
+			path = append(path, proofStep{Hash: hex.EncodeToString(level[index+1])})
+		}
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+	return path
+}
+
+// nextMerkleLevel hashes the pairs of nodes of a level of a Merkle tree,
+// promoting the last node if their number is odd
+func nextMerkleLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+		} else {
+			next = append(next, hashNodes(level[i], level[i+1]))
+		}
+	}
+	return next
+}
+
+// hashLeaf returns the hash of a value as a leaf of a Merkle tree
+func hashLeaf(value []byte) []byte {
+	hash := sha256.Sum256(append([]byte{0}, value...))
+	return hash[:]
+}
+
+// hashNodes returns the hash of two nodes of a Merkle tree
+func hashNodes(left []byte, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return hash[:]
+}
+
+// hashEventLeaf returns the hash of a saved event as a leaf of the Merkle
+// tree of an anchored batch. The tenant, key and txID are each prefixed with
+// their length as a 4 byte big endian number and hashed before the event, so
+// that the leaf commits to them.
+func hashEventLeaf(tenant string, key string, txId string, event []byte) []byte {
+	data := []byte{0}
+	for _, field := range []string{tenant, key, txId} {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(field)))
+		data = append(append(data, length...), field...)
+	}
+	hash := sha256.Sum256(append(data, event...))
+	return hash[:]
+}
+
+// hashBatchRoot returns the root of an anchored batch, chaining the root of
+// the Merkle tree of its leaves to the root of the previous batch, which is
+// empty for the first batch
+func hashBatchRoot(previousRoot []byte, treeRoot []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{2}, previousRoot...), treeRoot...))
+	return hash[:]
+}
+
+// getConfig reads the configuration stored by Init, or the default
+// configuration if none was passed, and fills in the defaults
+func getConfig(stub shim.ChaincodeStubInterface) (chaincodeConfig, error) {
+	// The default prefix is only kept when the stored configuration has no
+	// eventNamePrefix field, as an empty prefix is a valid configuration
+	prefix := defaultEventNamePrefix
+	config := chaincodeConfig{TenantAttribute: defaultTenantAttribute, AuditorAttribute: defaultAuditorAttribute, EventNamePrefix: &prefix, EventEmit: emitPayload}
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{})
+	if err != nil {
+		return config, err
+	}
+	configAsBytes, err := stub.GetState(configKey)
+	if err != nil || configAsBytes == nil {
+		return config, err
+	}
+	err = json.Unmarshal(configAsBytes, &config)
+	if config.TenantAttribute == "" {
+		config.TenantAttribute = defaultTenantAttribute
+	}
+	if config.AuditorAttribute == "" {
+		config.AuditorAttribute = defaultAuditorAttribute
+	}
+	if config.EventNamePrefix == nil {
+		config.EventNamePrefix = &prefix
+	}
+	if config.EventEmit == "" {
+		config.EventEmit = emitPayload
+	}
+	return config, err
+}
+
+// idempotencyRetention returns how long idempotency keys are remembered, 0
+// meaning forever
+func idempotencyRetention(config chaincodeConfig) (time.Duration, error) {
+	if config.IdempotencyRetention == "" {
+		return defaultIdempotencyRetention, nil
+	}
+	retention, err := time.ParseDuration(config.IdempotencyRetention)
+	if err == nil && retention < 0 {
+		err = fmt.Errorf("negative retention %s", config.IdempotencyRetention)
+	}
+	return retention, err
+}
+
+// getIdempotencyRecord returns the record of a processed idempotency key, or
+// nil if the key was never processed or has been purged
+func getIdempotencyRecord(stub shim.ChaincodeStubInterface, tenant string, idempotencyKey string) (*idempotencyRecord, error) {
+	recordKey, err := stub.CreateCompositeKey(idempotencyIndex, []string{tenant, idempotencyKey})
+	if err != nil {
+		return nil, err
+	}
+	recordAsBytes, err := stub.GetState(recordKey)
+	if err != nil || recordAsBytes == nil {
+		return nil, err
+	}
+	record := &idempotencyRecord{}
+	err = json.Unmarshal(recordAsBytes, record)
+	return record, err
+}
+
+// isExpired reports whether the retention of a processed idempotency key has
+// passed, in which case the key may be processed again
+func isExpired(stub shim.ChaincodeStubInterface, record *idempotencyRecord, now time.Time) (bool, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return false, err
+	}
+	retention, err := idempotencyRetention(config)
+	if err != nil || retention == 0 {
+		return false, err
+	}
+	processedAt, err := time.Parse(eventTimestampFormat, record.Timestamp)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(processedAt.Add(retention)), nil
+}
+
+// putIdempotencyRecord stores the record of an idempotency key processed for
+// a tenant and its entry in the time index, replacing the ones of a previous,
+// expired record of the same key
+func putIdempotencyRecord(stub shim.ChaincodeStubInterface, tenant string, idempotencyKey string, record idempotencyRecord, previous *idempotencyRecord) error {
+	if previous != nil {
+		previousTimeKey, err := stub.CreateCompositeKey(idempotencyTimeIndex, []string{previous.Timestamp, tenant, idempotencyKey})
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(previousTimeKey)
+		if err != nil {
+			return err
+		}
+	}
+	recordAsBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	recordKey, err := stub.CreateCompositeKey(idempotencyIndex, []string{tenant, idempotencyKey})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(recordKey, recordAsBytes)
+	if err != nil {
+		return err
+	}
+	timeKey, err := stub.CreateCompositeKey(idempotencyTimeIndex, []string{record.Timestamp, tenant, idempotencyKey})
+	if err != nil {
+		return err
+	}
+	// The time index only needs the key, its value is never read
+	return stub.PutState(timeKey, []byte(idempotencyKey))
+}
+
+// main function starts up the smart contract in the container during instantiate
+func main() {
+	logger.Debug("main() called.")
+	if err := shim.Start(new(SimpleAsset)); err != nil {
+		logger.Error("Error starting SimpleAsset smart contract: ", err)
+		fmt.Printf("Error starting SimpleAsset smart contract: %s", err)
+	}
+}
+
+// getHistoryByKey queries the ledger using key.
+// It retrieve all the changes to the value happened over time, oldest first.
+// An optional second argument limits the number of changes returned and an
+// optional third argument "true" returns the newest changes first, so that
+// the last N events of a key can be fetched. The key is read in the
+// namespace of the tenant of the caller or of the tenant passed as optional
+// fourth argument. When the tenant has no history for the key, the history of
+// the plain key written by version 1.0.0 is returned instead to the callers
+// allowed to read it, see tenantKey.
+func (t *SimpleAsset) getHistoryByKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getHistoryByKey called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 4 {
+		logger.Error("Incorrect number of arguments passed in getHistoryByKey.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 to 4 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+
+	key := args[0]
+	limit := 0
+	if len(args) > 1 && args[1] != "" {
+		var err error
+		limit, err = strconv.Atoi(args[1])
+		if err != nil || limit < 0 {
+			logger.Error("Invalid limit passed to getHistoryByKey(): ", args[1])
+			resp := shim.Error("Limit must be a non-negative number: " + args[1] + " given.")
+			resp.Status = 400
+			return resp
+		}
+	}
+	reverse := false
+	if len(args) > 2 && args[2] != "" {
+		var err error
+		reverse, err = strconv.ParseBool(args[2])
+		if err != nil {
+			logger.Error("Invalid reverse flag passed to getHistoryByKey(): ", args[2])
+			resp := shim.Error("Reverse must be true or false: " + args[2] + " given.")
+			resp.Status = 400
+			return resp
+		}
+	}
+
+	stateKey, legacyKey, resp, ok := tenantKey(stub, key, args, 3)
+	if !ok {
+		return resp
+	}
+	history, err := readHistory(stub, stateKey)
+	if err == nil && len(history) == 0 && legacyKey != "" {
+		history, err = readHistory(stub, legacyKey)
+	}
+	if err != nil {
+		logger.Error("Error occured while reading history: ", err)
+		return shim.Error("Error occured while calling GetHistoryForKey: " + err.Error())
+	}
+	if len(history) == 0 {
+		logger.Info("No history received for key : ", key)
+		resp := shim.Error("No history received for key: " + key)
+		resp.Status = 400
+		return resp
+	}
+
+	if reverse {
+		for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+			history[i], history[j] = history[j], history[i]
+		}
+	}
+	if limit > 0 && limit < len(history) {
+		history = history[:limit]
+	}
+
+	historyAsBytes, err := json.Marshal(history)
+	if err != nil {
+		logger.Error("Error occured while marshalling history: ", err)
+		return shim.Error("Failed to marshal history for key: " + key)
+	}
+	return shim.Success(historyAsBytes)
+}
+
+// readHistory returns the history of a state key, oldest first
+func readHistory(stub shim.ChaincodeStubInterface, stateKey string) ([]historyEntry, error) {
+	resultsIterator, err := stub.GetHistoryForKey(stateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	history := []historyEntry{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := historyEntry{
+			TxId:      response.TxId,
+			Value:     json.RawMessage("null"),
+			Timestamp: time.Unix(response.Timestamp.GetSeconds(), int64(response.Timestamp.GetNanos())).String(),
+			IsDelete:  strconv.FormatBool(response.IsDelete),
+		}
+		if !response.IsDelete {
+			entry.Value = eventValue(response.Value)
+		}
+		history = append(history, entry)
+	}
+	return history, nil
+}
+
+// getEventsByStream lists the events appended to a stream by saveNewEvent,
+// newest first. It expects the stream name and optionally the RFC 3339 times
+// from (inclusive) and to (exclusive) between which events were saved, a page
+// size, the bookmark returned by a previous call and the tenant of the stream,
+// by default the tenant of the caller. The time range bounds the range query
+// of streamTimeIndex, so events outside of it are never read.
+// Paginated requests are only supported in queries, not in transactions.
+func (t *SimpleAsset) getEventsByStream(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getEventsByStream called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 6 {
+		logger.Error("Incorrect number of arguments passed in getEventsByStream.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 to 6 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+
+	stream := args[0]
+	if stream == "" {
+		logger.Error("Empty stream passed to getEventsByStream()")
+		resp := shim.Error("Stream must not be empty.")
+		resp.Status = 400
+		return resp
+	}
+	var bounds [2]time.Time
+	for i := range bounds {
+		if len(args) > i+1 && args[i+1] != "" {
+			bound, err := time.Parse(time.RFC3339Nano, args[i+1])
+			if err != nil {
+				logger.Error("Invalid time passed to getEventsByStream(): ", args[i+1])
+				resp := shim.Error("From and to must be RFC 3339 times: " + args[i+1] + " given.")
+				resp.Status = 400
+				return resp
+			}
+			bounds[i] = bound
+		}
+	}
+	from, to := bounds[0], bounds[1]
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return shim.Error("Failed to get creator identity.")
+	}
+	tenant, resp, ok := resolveTenant(caller, args, 5)
+	if !ok {
+		return resp
+	}
+
+	startKey, endKey, err := streamTimeRange(stub, tenant, stream, from, to)
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		resp := shim.Error("Tenant and stream must be valid UTF-8 strings.")
+		resp.Status = 400
+		return resp
+	}
+
+	result := eventsPage{Events: []streamEvent{}}
+	if len(args) < 4 || args[3] == "" {
+		resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+		if err != nil {
+			logger.Error("Error occured while calling GetStateByRange(): ", err)
+			return shim.Error("Error occured while calling GetStateByRange: " + err.Error())
+		}
+		result.Events, err = readStreamEvents(stub, resultsIterator, result.Events)
+		resultsIterator.Close()
+		if err != nil {
+			logger.Error("Error occured while reading stream events: ", err)
+			return shim.Error("Error occured while calling getEventsByStream: " + err.Error())
+		}
+	} else {
+		pageSize, convErr := strconv.Atoi(args[3])
+		if convErr != nil || pageSize <= 0 {
+			logger.Error("Invalid page size passed to getEventsByStream(): ", args[3])
+			resp := shim.Error("Page size must be a positive number: " + args[3] + " given.")
+			resp.Status = 400
+			return resp
+		}
+		bookmark := ""
+		if len(args) > 4 {
+			bookmark = args[4]
+		}
+		resultsIterator, metadata, err := stub.GetStateByRangeWithPagination(startKey, endKey, int32(pageSize), bookmark)
+		if err != nil {
+			logger.Error("Error occured while calling GetStateByRangeWithPagination(): ", err)
+			return shim.Error("Error occured while calling GetStateByRangeWithPagination: " + err.Error())
+		}
+		result.Events, err = readStreamEvents(stub, resultsIterator, result.Events)
+		resultsIterator.Close()
+		if err != nil {
+			logger.Error("Error occured while reading stream events: ", err)
+			return shim.Error("Error occured while calling getEventsByStream: " + err.Error())
+		}
+		result.Bookmark = metadata.Bookmark
+	}
+	result.FetchedRecordsCount = int32(len(result.Events))
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling events: ", err)
+		return shim.Error("Failed to marshal events of stream: " + stream)
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// readStreamEvents appends the events listed by a streamTimeIndex iterator to
+// events. Entries whose event has been removed are skipped.
+func readStreamEvents(stub shim.ChaincodeStubInterface, resultsIterator shim.StateQueryIteratorInterface, events []streamEvent) ([]streamEvent, error) {
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return events, err
+		}
+		_, attributes, err := stub.SplitCompositeKey("\x00" + strings.TrimPrefix(response.Key, rangeKeyPrefix))
+		if err != nil || len(attributes) != 5 {
+			return events, fmt.Errorf("invalid stream time key: %q", response.Key)
+		}
+		inverseNanos, err := strconv.ParseInt(attributes[2], 10, 64)
+		if err != nil {
+			return events, fmt.Errorf("invalid stream time key: %q", response.Key)
+		}
+		timestamp := time.Unix(0, math.MaxInt64-inverseNanos).UTC()
+		stateKey, err := stub.CreateCompositeKey(streamIndex, []string{attributes[0], attributes[1], attributes[3], timestamp.Format(eventTimestampFormat), attributes[4]})
+		if err != nil {
+			return events, err
+		}
+		value, err := stub.GetState(stateKey)
+		if err != nil {
+			return events, err
+		}
+		if value == nil {
+			continue
+		}
+		events = append(events, streamEvent{
+			Tenant:    attributes[0],
+			Stream:    attributes[1],
+			Key:       attributes[3],
+			Timestamp: timestamp.Format(time.RFC3339Nano),
+			TxId:      attributes[4],
+			Value:     eventValue(value),
+		})
+	}
+	return events, nil
+}
+
+// rangeKey builds a key of an index read with range queries, such as
+// streamTimeIndex, from its leading attributes
+func rangeKey(stub shim.ChaincodeStubInterface, objectType string, attributes ...string) (string, error) {
+	compositeKey, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", err
+	}
+	return rangeKeyPrefix + compositeKey[1:], nil
+}
+
+// inverseTime formats a time as the zero padded number of nanoseconds left
+// until the largest time, so that later times sort first. Times before the
+// Unix epoch are formatted as the epoch.
+func inverseTime(t time.Time) string {
+	nanos := t.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	return fmt.Sprintf("%019d", math.MaxInt64-nanos)
+}
+
+// streamTimeRange returns the start key (inclusive) and end key (exclusive)
+// of the streamTimeIndex entries of a stream saved between from (inclusive)
+// and to (exclusive). Zero times do not bound the range.
+func streamTimeRange(stub shim.ChaincodeStubInterface, tenant string, stream string, from time.Time, to time.Time) (string, string, error) {
+	startKey, err := rangeKey(stub, streamTimeIndex, tenant, stream)
+	if err != nil {
+		return "", "", err
+	}
+	endKey := startKey + string(utf8.MaxRune)
+	// Later times sort first: the range starts right after to and ends
+	// right after from
+	if !to.IsZero() {
+		startKey, err = rangeKey(stub, streamTimeIndex, tenant, stream, inverseTime(to.Add(-time.Nanosecond)))
+	}
+	if err == nil && !from.IsZero() {
+		endKey, err = rangeKey(stub, streamTimeIndex, tenant, stream, inverseTime(from.Add(-time.Nanosecond)))
+	}
+	return startKey, endKey, err
+}
+
+// putStreamTimeEntry indexes an event appended to a stream in streamTimeIndex
+func putStreamTimeEntry(stub shim.ChaincodeStubInterface, tenant string, stream string, key string, timestamp time.Time, txID string) error {
+	entryKey, err := rangeKey(stub, streamTimeIndex, tenant, stream, inverseTime(timestamp), key, txID)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(entryKey, []byte{0x00})
+}
+
+// delStreamTimeEntry removes the streamTimeIndex entry of an event
+func delStreamTimeEntry(stub shim.ChaincodeStubInterface, tenant string, stream string, key string, timestamp time.Time, txID string) error {
+	entryKey, err := rangeKey(stub, streamTimeIndex, tenant, stream, inverseTime(timestamp), key, txID)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(entryKey)
+}
+
+// queryEvents runs a CouchDB rich query over the stored events. It expects a
+// selector such as {"docType": "Event"}, or a complete query holding a
+// "selector" field, and optionally a page size, the bookmark returned by a
+// previous call and a tenant. Only events of the tenant are returned, by
+// default the tenant of the caller; auditors passing no tenant query the
+// events of every tenant. Other documents, such as subscriptions, are never
+// returned. Paginated requests are only supported in queries,
+// not in transactions. Rich queries require CouchDB as state database.
+func (t *SimpleAsset) queryEvents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("queryEvents called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 4 {
+		logger.Error("Incorrect number of arguments passed in queryEvents.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 to 4 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(args[0]), &query); err != nil || query == nil {
+		logger.Error("Invalid selector passed to queryEvents(): ", args[0])
+		resp := shim.Error("Selector must be a JSON object: " + args[0] + " given.")
+		resp.Status = 400
+		return resp
+	}
+	if _, found := query["selector"]; !found {
+		query = map[string]json.RawMessage{"selector": json.RawMessage(args[0])}
+	}
+	return runQuery(stub, query, args[1:])
+}
+
+// queryEventsBySource lists the events logged by an application, as named in
+// their docType field. It expects the name of the application and optionally
+// a page size, a bookmark and a tenant, like queryEvents.
+func (t *SimpleAsset) queryEventsBySource(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("queryEventsBySource called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 4 {
+		logger.Error("Incorrect number of arguments passed in queryEventsBySource.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 to 4 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+
+	selector, err := json.Marshal(map[string]string{sourceField: args[0]})
+	if err != nil {
+		logger.Error("Error occured while marshalling selector: ", err)
+		return shim.Error("Failed to build query.")
+	}
+	return runQuery(stub, map[string]json.RawMessage{"selector": selector}, args[1:])
+}
+
+// queryEventsByDate lists the events saved between two RFC 3339 times, from
+// (inclusive) and to (exclusive), based on the transaction timestamp stamped
+// in their metadata. Either time may be empty to leave that end of the range
+// open. It optionally takes a page size, a bookmark and a tenant, like
+// queryEvents.
+func (t *SimpleAsset) queryEventsByDate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("queryEventsByDate called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 2 || len(args) > 5 {
+		logger.Error("Incorrect number of arguments passed in queryEventsByDate.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 2 to 5 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+
+	condition := map[string]interface{}{"$exists": true}
+	for i, operator := range []string{"$gte", "$lt"} {
+		if args[i] == "" {
+			continue
+		}
+		bound, err := time.Parse(time.RFC3339Nano, args[i])
+		if err != nil {
+			logger.Error("Invalid time passed to queryEventsByDate(): ", args[i])
+			resp := shim.Error("From and to must be RFC 3339 times: " + args[i] + " given.")
+			resp.Status = 400
+			return resp
+		}
+		condition[operator] = bound.UTC().Format(eventTimestampFormat)
+	}
+	selector, err := json.Marshal(map[string]interface{}{metaField + ".timestamp": condition})
+	if err != nil {
+		logger.Error("Error occured while marshalling selector: ", err)
+		return shim.Error("Failed to build query.")
+	}
+	return runQuery(stub, map[string]json.RawMessage{"selector": selector}, args[2:])
+}
+
+// runQuery runs a CouchDB query, paginated when a page size is passed in
+// pageArgs, optionally followed by a bookmark. The selector is restricted to
+// events, the only documents carrying the metaField, and to the tenant
+// resolved from the caller and the optional third argument of pageArgs,
+// except for auditors passing no tenant.
+func runQuery(stub shim.ChaincodeStubInterface, query map[string]json.RawMessage, pageArgs []string) peer.Response {
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return shim.Error("Failed to get creator identity.")
+	}
+	tenant, resp, ok := resolveTenant(caller, pageArgs, 2)
+	if !ok {
+		return resp
+	}
+	conditions := []interface{}{query["selector"], map[string]interface{}{metaField + ".txId": map[string]bool{"$exists": true}}}
+	if !caller.Auditor || (len(pageArgs) > 2 && pageArgs[2] != "") {
+		conditions = append(conditions, map[string]string{metaField + ".tenant": tenant})
+	}
+	selector, err := json.Marshal(map[string]interface{}{"$and": conditions})
+	if err != nil {
+		logger.Error("Error occured while marshalling selector: ", err)
+		return shim.Error("Failed to build query.")
+	}
+	query["selector"] = selector
+
+	queryAsBytes, err := json.Marshal(query)
+	if err != nil {
+		logger.Error("Error occured while marshalling query: ", err)
+		return shim.Error("Failed to build query.")
+	}
+	queryString := string(queryAsBytes)
+	logger.Debug("queryString: ", queryString)
+
+	var resultsIterator shim.StateQueryIteratorInterface
+	result := queryPage{Records: []queryRecord{}}
+	if len(pageArgs) == 0 || pageArgs[0] == "" {
+		resultsIterator, err = stub.GetQueryResult(queryString)
+	} else {
+		pageSize, convErr := strconv.Atoi(pageArgs[0])
+		if convErr != nil || pageSize <= 0 {
+			logger.Error("Invalid page size passed to query: ", pageArgs[0])
+			resp := shim.Error("Page size must be a positive number: " + pageArgs[0] + " given.")
+			resp.Status = 400
+			return resp
+		}
+		bookmark := ""
+		if len(pageArgs) > 1 {
+			bookmark = pageArgs[1]
+		}
+		var metadata *peer.QueryResponseMetadata
+		resultsIterator, metadata, err = stub.GetQueryResultWithPagination(queryString, int32(pageSize), bookmark)
+		if err == nil {
+			result.FetchedRecordsCount = metadata.FetchedRecordsCount
+			result.Bookmark = metadata.Bookmark
+		}
+	}
+	if err != nil {
+		logger.Error("Error occured while calling GetQueryResult(): ", err)
+		return shim.Error("Error occured while calling GetQueryResult: " + err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			logger.Error("Error occured while calling resultsIterator.Next(): ", err)
+			return shim.Error("Error occured while calling queryEvents (resultsIterator): " + err.Error())
+		}
+		record := queryRecord{Key: response.Key, Value: eventValue(response.Value)}
+		// Events are stored under composite keys, which start with a null
+		// character, except those saved by earlier versions
+		if strings.HasPrefix(response.Key, "\x00") {
+			objectType, attributes, err := stub.SplitCompositeKey(response.Key)
+			if err == nil && objectType == tenantIndex && len(attributes) == 2 {
+				record.Tenant, record.Key = attributes[0], attributes[1]
+			} else if err == nil && objectType == streamIndex && len(attributes) == 5 {
+				record.Tenant, record.Stream, record.Key = attributes[0], attributes[1], attributes[2]
+			}
+		}
+		result.Records = append(result.Records, record)
+	}
+	if len(pageArgs) == 0 || pageArgs[0] == "" {
+		result.FetchedRecordsCount = int32(len(result.Records))
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error occured while marshalling query result: ", err)
+		return shim.Error("Failed to marshal query result.")
+	}
+	return shim.Success(resultAsBytes)
+}
+
+// normalizeEvent decodes an event payload into the fields of a JSON object.
+// Payloads that are not JSON objects are wrapped as {"raw": ...}. Payloads
+// already holding the reserved metaField are rejected.
+func normalizeEvent(eventAsString string) (map[string]json.RawMessage, error) {
+	event := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(eventAsString), &event); err != nil || event == nil {
+		raw, err := json.Marshal(eventAsString)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]json.RawMessage{rawField: raw}, nil
+	}
+	if _, found := event[metaField]; found {
+		return nil, fmt.Errorf("Event must not contain the reserved field %s.", metaField)
+	}
+	return event, nil
+}
+
+// getCaller reads the identity that submitted the transaction. The tenant
+// and auditor attributes are read from its certificate, if it has one.
+func getCaller(stub shim.ChaincodeStubInterface) (callerIdentity, error) {
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	identity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(creator, identity); err != nil {
+		return callerIdentity{}, err
+	}
+	caller := callerIdentity{MSPID: identity.Mspid, Tenant: identity.Mspid}
+	if len(identity.IdBytes) == 0 {
+		return caller, nil
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	clientIdentity, err := cid.New(stub)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	tenant, found, err := clientIdentity.GetAttributeValue(config.TenantAttribute)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	if found && tenant != "" {
+		caller.Tenant = identity.Mspid + "/" + tenant
+	}
+	auditor, found, err := clientIdentity.GetAttributeValue(config.AuditorAttribute)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	caller.Auditor = found && auditor == "true"
+	return caller, nil
+}
+
+// resolveTenant returns the tenant whose events a request reads or writes:
+// the tenant passed as args[index] when present, the tenant of the caller
+// otherwise. Only auditors may pass another tenant than their own.
+func resolveTenant(caller callerIdentity, args []string, index int) (string, peer.Response, bool) {
+	if len(args) <= index || args[index] == "" || args[index] == caller.Tenant {
+		return caller.Tenant, peer.Response{}, true
+	}
+	tenant := args[index]
+	if caller.Auditor {
+		return tenant, peer.Response{}, true
+	}
+	logger.Info("Access denied to tenant : ", tenant)
+	resp := shim.Error("Access denied to the events of tenant " + tenant + ".")
+	resp.Status = 403
+	return "", resp, false
+}
+
+// tenantKey returns the composite key under which an event is stored in the
+// namespace of the tenant resolved from the caller and args[index], and the
+// plain key under which version 1.0.0 stored it when the caller may read the
+// events of that version: auditors, and the callers of the configured legacy
+// tenant. The plain key is empty for other callers.
+func tenantKey(stub shim.ChaincodeStubInterface, key string, args []string, index int) (string, string, peer.Response, bool) {
+	caller, err := getCaller(stub)
+	if err != nil {
+		logger.Error("Error occured while reading creator identity: ", err)
+		return "", "", shim.Error("Failed to get creator identity."), false
+	}
+	tenant, resp, ok := resolveTenant(caller, args, index)
+	if !ok {
+		return "", "", resp, false
+	}
+	stateKey, err := stub.CreateCompositeKey(tenantIndex, []string{tenant, key})
+	if err != nil {
+		logger.Error("Error occured while calling CreateCompositeKey(): ", err)
+		resp := shim.Error("Tenant and key must be valid UTF-8 strings.")
+		resp.Status = 400
+		return "", "", resp, false
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		logger.Error("Error occured while reading configuration: ", err)
+		return "", "", shim.Error("Failed to read configuration."), false
+	}
+	legacyKey := ""
+	if caller.Auditor || (config.LegacyTenant != "" && caller.Tenant == config.LegacyTenant) {
+		legacyKey = key
+	}
+	return stateKey, legacyKey, peer.Response{}, true
+}
+
+// eventValue returns a stored event as-is when it is JSON, and as a JSON
+// string otherwise
+func eventValue(event []byte) json.RawMessage {
+	if json.Valid(event) {
+		return json.RawMessage(event)
+	}
+	value, _ := json.Marshal(string(event))
+	return value
+}
+
+// getKeyDetails queries using key.
+// It retrieves the latest state of the value, in the namespace of the tenant
+// of the caller or of the tenant passed as optional second argument. When the
+// tenant holds no event under the key, the event saved under the plain key by
+// version 1.0.0, which had no tenants, is returned instead to the callers
+// allowed to read it, see tenantKey.
+func (t *SimpleAsset) getKeyDetails(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	logger.Debug("getKeyDetails called.")
+
+	// Essential check to verify number of arguments
+	if len(args) < 1 || len(args) > 2 {
+		logger.Error("Incorrect number of arguments passed in getKeyDetails.")
+		resp := shim.Error("Incorrect number of arguments. Expecting 1 or 2 arguments: " + strconv.Itoa(len(args)) + " given.")
+		resp.Status = 400
+		return resp
+	}
+
+	key := args[0]
+	if key == "" {
+		logger.Error("Empty key passed to getKeyDetails()")
+		resp := shim.Error("Key must not be empty.")
+		resp.Status = 400
+		return resp
+	} else {
+		stateKey, legacyKey, resp, ok := tenantKey(stub, key, args, 1)
+		if !ok {
+			return resp
+		}
+		valueAsBytes, err := stub.GetState(stateKey)
+		if err == nil && valueAsBytes == nil && legacyKey != "" {
+			valueAsBytes, err = stub.GetState(legacyKey)
+		}
 		if err != nil {
 			logger.Error("Error occured while calling GetState(): ", err)
 			return shim.Error("Failed to get state for id=" + key)
@@ -1,12 +1,175 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	"github.com/hyperledger/fabric/protos/peer"
 )
 
+// historyStub serves a fixed key history, as GetHistoryForKey is not
+// implemented in mockstub. When key is set, only that key has a history.
+type historyStub struct {
+	*shim.MockStub
+	history []*queryresult.KeyModification
+	key     string
+}
+
+func newHistoryStub(history ...*queryresult.KeyModification) *historyStub {
+	return &historyStub{MockStub: shim.NewMockStub("mockstub", new(SimpleAsset)), history: history}
+}
+
+func (stub *historyStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	if stub.key != "" && key != stub.key {
+		return &historyIterator{}, nil
+	}
+	return &historyIterator{history: stub.history}, nil
+}
+
+// historyIterator iterates over the history of a historyStub
+type historyIterator struct {
+	history []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.history) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	next := it.history[0]
+	it.history = it.history[1:]
+	return next, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+// queryStub records the rich queries it receives and serves fixed results,
+// as GetQueryResult is not implemented in mockstub
+type queryStub struct {
+	*shim.MockStub
+	queries []string
+	results []*queryresult.KV
+}
+
+func newQueryStub(results ...*queryresult.KV) *queryStub {
+	return &queryStub{MockStub: shim.NewMockStub("mockstub", new(SimpleAsset)), results: results}
+}
+
+func (stub *queryStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	stub.queries = append(stub.queries, query)
+	return &queryIterator{results: stub.results}, nil
+}
+
+// queryIterator iterates over the results of a queryStub
+type queryIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *queryIterator) HasNext() bool {
+	return len(it.results) > 0
+}
+
+func (it *queryIterator) Next() (*queryresult.KV, error) {
+	next := it.results[0]
+	it.results = it.results[1:]
+	return next, nil
+}
+
+func (it *queryIterator) Close() error {
+	return nil
+}
+
+// paginationStub serves pages of the partial composite key and range queries
+// of the mockstub, as GetStateByPartialCompositeKeyWithPagination and
+// GetStateByRangeWithPagination are not implemented in mockstub. Bookmarks
+// are the last key of the previous page.
+type paginationStub struct {
+	*shim.MockStub
+}
+
+func (stub *paginationStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return readPage(resultsIterator, pageSize, bookmark)
+}
+
+func (stub *paginationStub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return readPage(resultsIterator, pageSize, bookmark)
+}
+
+// readPage reads the page of pageSize results following bookmark
+func readPage(resultsIterator shim.StateQueryIteratorInterface, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	page := &queryIterator{}
+	for resultsIterator.HasNext() && int32(len(page.results)) < pageSize {
+		result, _ := resultsIterator.Next()
+		if result.Key > bookmark {
+			page.results = append(page.results, result)
+			bookmark = result.Key
+		}
+	}
+	return page, &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(page.results)), Bookmark: bookmark}, nil
+}
+
+// tenantState returns the event stored under a key in the namespace of a
+// tenant
+func tenantState(stub *shim.MockStub, tenant string, key string) []byte {
+	stateKey, _ := stub.CreateCompositeKey(tenantIndex, []string{tenant, key})
+	return stub.State[stateKey]
+}
+
+// newCreator returns a serialized identity of an MSP, without certificate
+func newCreator(mspID string) []byte {
+	creator, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID})
+	return creator
+}
+
+// attributesOID is the certificate extension holding the attributes read by
+// the client identity library
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// newCertifiedCreator returns a serialized identity of an MSP holding a
+// self-signed certificate with the given attributes
+func newCertifiedCreator(mspID string, attrs map[string]string) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "user1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	attrsAsBytes, _ := json.Marshal(map[string]map[string]string{"attrs": attrs})
+	template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attrsAsBytes}}
+	certAsBytes, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	certAsPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes})
+	creator, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: certAsPEM})
+	return creator
+}
+
 func Test_Init(t *testing.T) {
 	simpleCC := new(SimpleAsset)
 	mockStub := shim.NewMockStub("mockstub", simpleCC)
@@ -77,6 +240,24 @@ func Test_Main(t *testing.T) {
 	main()
 }
 
+func Test_getVersion(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getVersion(mockStub)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if string(response.GetPayload()) != "Zapier:1.1.0" {
+		fmt.Println("getVersion test failed")
+		t.FailNow()
+	}
+}
+
 func Test_saveNewEvent(t *testing.T) {
 	simpleCC := new(SimpleAsset)
 	mockStub := shim.NewMockStub("mockstub", simpleCC)
@@ -101,7 +282,7 @@ func Test_saveNewEvent_incorrectArgs(t *testing.T) {
 	mockStub := shim.NewMockStub("mockstub", simpleCC)
 	txId := "mockTxID"
 
-	args := []string{"key", "value1", "value2"}
+	args := []string{"key", "value1", "stream1", "idempotencyKey1", "tenant1", "type1", "value2"}
 	mockStub.MockTransactionStart(txId)
 	response := simpleCC.saveNewEvent(mockStub, args)
 	mockStub.MockTransactionEnd(txId)
@@ -179,7 +360,7 @@ func Test_getKeyDetails_incorrectArgs(t *testing.T) {
 	mockStub := shim.NewMockStub("mockstub", simpleCC)
 	txId := "mockTxID"
 
-	args := []string{"key1", "key2"}
+	args := []string{"key1", "tenant1", "key2"}
 	mockStub.MockTransactionStart(txId)
 	response := simpleCC.getKeyDetails(mockStub, args)
 	mockStub.MockTransactionEnd(txId)
@@ -234,30 +415,114 @@ func Test_getHistoryByKey(t *testing.T) {
 	}
 }
 
-// func Test_getHistoryByKey_nodata(t *testing.T) {
-// 	simpleCC := new(SimpleAsset)
-// 	mockStub := shim.NewMockStub("mockstub", simpleCC)
-// 	txId := "mockTxID"
+func Test_getHistoryByKey_nodata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	txId := "mockTxID"
+
+	args := []string{"key1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getHistoryByKey_nodata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistoryByKey_history(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub(
+		&queryresult.KeyModification{TxId: "tx1", Value: []byte("value1"), Timestamp: &timestamp.Timestamp{Seconds: 1}},
+		&queryresult.KeyModification{TxId: "tx2", Value: []byte(`{"event":"value2"}`), Timestamp: &timestamp.Timestamp{Seconds: 2}},
+		&queryresult.KeyModification{TxId: "tx3", IsDelete: true, Timestamp: &timestamp.Timestamp{Seconds: 3}},
+	)
+	txId := "mockTxID"
+
+	args := []string{"key1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var history []map[string]interface{}
+	if err := json.Unmarshal(response.GetPayload(), &history); err != nil || len(history) != 3 {
+		fmt.Println("getHistoryByKey_history test failed")
+		t.FailNow()
+	}
+	if history[0]["TxId"] != "tx1" || history[0]["Value"] != "value1" || history[0]["IsDelete"] != "false" {
+		fmt.Println("getHistoryByKey_history test failed")
+		t.FailNow()
+	}
+	if value, ok := history[1]["Value"].(map[string]interface{}); !ok || value["event"] != "value2" {
+		fmt.Println("getHistoryByKey_history test failed")
+		t.FailNow()
+	}
+	if history[2]["Value"] != nil || history[2]["IsDelete"] != "true" {
+		fmt.Println("getHistoryByKey_history test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistoryByKey_lastEvents(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub(
+		&queryresult.KeyModification{TxId: "tx1", Value: []byte("value1"), Timestamp: &timestamp.Timestamp{Seconds: 1}},
+		&queryresult.KeyModification{TxId: "tx2", Value: []byte("value2"), Timestamp: &timestamp.Timestamp{Seconds: 2}},
+		&queryresult.KeyModification{TxId: "tx3", Value: []byte("value3"), Timestamp: &timestamp.Timestamp{Seconds: 3}},
+	)
+	txId := "mockTxID"
+
+	args := []string{"key1", "2", "true"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var history []map[string]interface{}
+	if err := json.Unmarshal(response.GetPayload(), &history); err != nil || len(history) != 2 {
+		fmt.Println("getHistoryByKey_lastEvents test failed")
+		t.FailNow()
+	}
+	if history[0]["TxId"] != "tx3" || history[1]["TxId"] != "tx2" {
+		fmt.Println("getHistoryByKey_lastEvents test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getHistoryByKey_invalidLimit(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	txId := "mockTxID"
+
+	args := []string{"key1", "-1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
 
-// 	args := []string{"key1"}
-// 	mockStub.MockTransactionStart(txId)
-// 	response := simpleCC.getHistoryByKey(mockStub, args)
-// 	mockStub.MockTransactionEnd(txId)
-// 	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
-// 	fmt.Println("Payload: " + string(response.GetPayload()))
-// 	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getHistoryByKey_invalidLimit test failed")
+		t.FailNow()
+	}
+}
 
-// 	if s := response.GetStatus(); s != 400 {
-// 		fmt.Println("getHistoryByKey_nodata test failed")
-// 		t.FailNow()
-// 	}
-// }
 func Test_getHistoryByKey_incorrectArgs(t *testing.T) {
 	simpleCC := new(SimpleAsset)
 	mockStub := shim.NewMockStub("mockstub", simpleCC)
 	txId := "mockTxID"
 
-	args := []string{"key1", "key2"}
+	args := []string{"key1", "1", "true", "tenant1", "value1"}
 	mockStub.MockTransactionStart(txId)
 	response := simpleCC.getHistoryByKey(mockStub, args)
 	mockStub.MockTransactionEnd(txId)
@@ -270,3 +535,1390 @@ func Test_getHistoryByKey_incorrectArgs(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func Test_saveNewEvent_stream(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2"} {
+		args := []string{"key1", "value" + fmt.Sprint(i+1), "stream1"}
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != 200 {
+			fmt.Println("saveNewEvent_stream test failed")
+			t.FailNow()
+		}
+	}
+
+	// Events saved in append-only mode do not overwrite the key
+	streamKeys := 0
+	for key := range mockStub.State {
+		if strings.HasPrefix(key, "\x00"+streamIndex) {
+			streamKeys++
+		}
+	}
+	if streamKeys != 2 || tenantState(mockStub, "", "key1") != nil {
+		fmt.Println("saveNewEvent_stream test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getEventsByStream(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2", "mockTxID3"} {
+		args := []string{"key1", "{\"count\":" + fmt.Sprint(i+1) + "}", "stream1"}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(1000 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+	mockStub.MockTransactionStart("mockTxID4")
+	simpleCC.saveNewEvent(mockStub, []string{"key2", "value", "stream2"})
+	mockStub.MockTransactionEnd("mockTxID4")
+
+	txId := "mockTxID"
+	args := []string{"stream1", "1970-01-01T00:30:00Z", "1970-01-01T00:50:00Z"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getEventsByStream(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var page eventsPage
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 1 {
+		fmt.Println("getEventsByStream test failed")
+		t.FailNow()
+	}
+	var value map[string]interface{}
+	if event := page.Events[0]; event.Key != "key1" || event.TxId != "mockTxID2" || json.Unmarshal(event.Value, &value) != nil || value["count"] != 2.0 {
+		fmt.Println("getEventsByStream test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getEventsByStream_newestFirst(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	for i, key := range []string{"key2", "key1", "key3"} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(1000 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, []string{key, "value", "stream1"})
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	txId := "mockTxID"
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getEventsByStream(mockStub, []string{"stream1", "1970-01-01T00:16:40Z", "1970-01-01T00:50:00Z"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var page eventsPage
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 2 {
+		fmt.Println("getEventsByStream_newestFirst test failed")
+		t.FailNow()
+	}
+	if page.Events[0].Key != "key1" || page.Events[1].Key != "key2" || page.Events[1].Timestamp != "1970-01-01T00:16:40Z" {
+		fmt.Println("getEventsByStream_newestFirst test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getEventsByStream_invalidTime(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"stream1", "yesterday"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getEventsByStream(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getEventsByStream_invalidTime test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getEventsByStream_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getEventsByStream(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getEventsByStream_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_metadata(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"key1", "{\"name\":\"value1\"}"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var event struct {
+		Name string    `json:"name"`
+		Meta eventMeta `json:"~meta"`
+	}
+	if err := json.Unmarshal(tenantState(mockStub, "", "key1"), &event); err != nil || event.Name != "value1" || event.Meta.TxId != txId || event.Meta.Timestamp == "" {
+		fmt.Println("saveNewEvent_metadata test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_raw(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"key1", "name=value1&other=value2"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(tenantState(mockStub, "", "key1"), &event); err != nil || event["raw"] != "name=value1&other=value2" || event["~meta"] == nil {
+		fmt.Println("saveNewEvent_raw test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_reservedField(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"key1", "{\"~meta\":{}}"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("saveNewEvent_reservedField test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEvents(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newQueryStub(&queryresult.KV{Key: "key1", Value: []byte("{\"docType\":\"Event\"}")})
+	txId := "mockTxID"
+
+	args := []string{"{\"docType\":\"Event\"}"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEvents(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if len(mockStub.queries) != 1 || mockStub.queries[0] != "{\"selector\":{\"$and\":[{\"docType\":\"Event\"},{\"~meta.txId\":{\"$exists\":true}},{\"~meta.tenant\":\"\"}]}}" {
+		fmt.Println("queryEvents test failed")
+		t.FailNow()
+	}
+	var page queryPage
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Records) != 1 || page.Records[0].Key != "key1" {
+		fmt.Println("queryEvents test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEvents_auditor(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newQueryStub()
+	mockStub.Creator = newCertifiedCreator("Org1MSP", map[string]string{"zapier.auditor": "true"})
+	txId := "mockTxID"
+
+	args := []string{"{\"docType\":\"Event\"}"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEvents(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if len(mockStub.queries) != 1 || mockStub.queries[0] != "{\"selector\":{\"$and\":[{\"docType\":\"Event\"},{\"~meta.txId\":{\"$exists\":true}}]}}" {
+		fmt.Println("queryEvents_auditor test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEvents_invalidSelector(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newQueryStub()
+	txId := "mockTxID"
+
+	args := []string{"docType=Event"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEvents(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("queryEvents_invalidSelector test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEvents_pagination(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"{\"docType\":\"Event\"}", "10", ""}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEvents(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// change error code here once GetQueryResultWithPagination is implemented in mockstub
+	if s := response.GetStatus(); s != 500 {
+		fmt.Println("queryEvents_pagination test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEventsBySource(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newQueryStub()
+	txId := "mockTxID"
+
+	args := []string{"Event"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEventsBySource(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if len(mockStub.queries) != 1 || mockStub.queries[0] != "{\"selector\":{\"$and\":[{\"docType\":\"Event\"},{\"~meta.txId\":{\"$exists\":true}},{\"~meta.tenant\":\"\"}]}}" {
+		fmt.Println("queryEventsBySource test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEventsByDate(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newQueryStub()
+	txId := "mockTxID"
+
+	args := []string{"2019-01-01T00:00:00Z", ""}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEventsByDate(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if len(mockStub.queries) != 1 || mockStub.queries[0] != "{\"selector\":{\"$and\":[{\"~meta.timestamp\":{\"$exists\":true,\"$gte\":\"2019-01-01T00:00:00.000000000Z\"}},{\"~meta.txId\":{\"$exists\":true}},{\"~meta.tenant\":\"\"}]}}" {
+		fmt.Println("queryEventsByDate test failed")
+		t.FailNow()
+	}
+}
+
+func Test_queryEventsByDate_invalidTime(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newQueryStub()
+	txId := "mockTxID"
+
+	args := []string{"", "tomorrow"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.queryEventsByDate(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("queryEventsByDate_invalidTime test failed")
+		t.FailNow()
+	}
+}
+
+func Test_Init_config(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	response := mockStub.MockInit(txId, [][]byte{[]byte("init"), []byte("{\"idempotencyRetention\":\"72h\"}")})
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("Init_config test failed")
+		t.FailNow()
+	}
+
+	response = mockStub.MockInit(txId, [][]byte{[]byte("init"), []byte("{\"idempotencyRetention\":\"-1h\"}")})
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("Init_config test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_idempotencyKey(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2"} {
+		args := []string{"key1", "value" + fmt.Sprint(i+1), "", "idempotencyKey1"}
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != 200 || string(response.GetPayload()) != "key1" {
+			fmt.Println("saveNewEvent_idempotencyKey test failed")
+			t.FailNow()
+		}
+	}
+
+	// The retried request must not overwrite the original event
+	var event map[string]interface{}
+	if err := json.Unmarshal(tenantState(mockStub, "", "key1"), &event); err != nil || event["raw"] != "value1" {
+		fmt.Println("saveNewEvent_idempotencyKey test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_idempotencyKeyExpired(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"idempotencyRetention\":\"1h\"}")})
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2"} {
+		args := []string{"key1", "value" + fmt.Sprint(i+1), "", "idempotencyKey1"}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(7200 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	// The idempotency key was processed again once its retention had passed
+	var event map[string]interface{}
+	if err := json.Unmarshal(tenantState(mockStub, "", "key1"), &event); err != nil || event["raw"] != "value2" {
+		fmt.Println("saveNewEvent_idempotencyKeyExpired test failed")
+		t.FailNow()
+	}
+}
+
+func Test_purgeIdempotencyKeys(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"idempotencyRetention\":\"1h\"}")})
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2", "mockTxID3"} {
+		args := []string{"key" + fmt.Sprint(i+1), "value", "", "idempotencyKey" + fmt.Sprint(i+1)}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(3600 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	txId := "mockTxID"
+	args := []string{"1"}
+	mockStub.MockTransactionStart(txId)
+	mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: 3600 * 3}
+	response := simpleCC.purgeIdempotencyKeys(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// Only the first two keys have expired, and one is purged per transaction
+	if string(response.GetPayload()) != "{\"purged\":1,\"more\":true}" {
+		fmt.Println("purgeIdempotencyKeys test failed")
+		t.FailNow()
+	}
+}
+
+func Test_purgeIdempotencyKeys_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"0"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.purgeIdempotencyKeys(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("purgeIdempotencyKeys_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_tenant(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	team1 := newCertifiedCreator("Org1MSP", map[string]string{"zapier.tenant": "team1"})
+
+	for i, creator := range [][]byte{newCreator("Org1MSP"), team1} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		args := []string{"key1", "value" + fmt.Sprint(i+1)}
+		mockStub.Creator = creator
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != 200 {
+			fmt.Println("saveNewEvent_tenant test failed")
+			t.FailNow()
+		}
+	}
+
+	// The same key is stored once per tenant
+	txId := "mockTxID"
+	args := []string{"key1", "Org1MSP/team1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getKeyDetails(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(response.GetPayload(), &event); err != nil || event["raw"] != "value2" {
+		fmt.Println("saveNewEvent_tenant test failed")
+		t.FailNow()
+	}
+	if err := json.Unmarshal(tenantState(mockStub, "Org1MSP", "key1"), &event); err != nil || event["raw"] != "value1" {
+		fmt.Println("saveNewEvent_tenant test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_otherTenant(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	// Only auditors may name another tenant, even of their own MSP
+	for _, c := range []struct {
+		creator []byte
+		status  int32
+	}{
+		{newCreator("Org1MSP"), 403},
+		{newCertifiedCreator("Org1MSP", map[string]string{"zapier.tenant": "team2"}), 403},
+		{newCertifiedCreator("Org2MSP", map[string]string{"zapier.auditor": "true"}), 200},
+	} {
+		args := []string{"key1", "value1", "", "", "Org1MSP/team1"}
+		mockStub.Creator = c.creator
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != c.status {
+			fmt.Println("saveNewEvent_otherTenant test failed")
+			t.FailNow()
+		}
+	}
+	if tenantState(mockStub, "Org1MSP/team1", "key1") == nil {
+		fmt.Println("saveNewEvent_otherTenant test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getKeyDetails_legacy(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"legacyTenant\":\"Org1MSP\"}")})
+	mockStub.Creator = newCreator("Org1MSP")
+	// Event saved by version 1.0.0 under its plain key
+	mockStub.State["key1"] = []byte("{\"name\":\"legacy\"}")
+	txId := "mockTxID"
+
+	for _, expected := range []string{"legacy", "value1"} {
+		args := []string{"key1"}
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.getKeyDetails(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		var event map[string]interface{}
+		if err := json.Unmarshal(response.GetPayload(), &event); err != nil || event["name"] != expected {
+			fmt.Println("getKeyDetails_legacy test failed")
+			t.FailNow()
+		}
+
+		// Events of the tenant take precedence over the legacy event
+		mockStub.MockTransactionStart(txId)
+		simpleCC.saveNewEvent(mockStub, []string{"key1", "{\"name\":\"value1\"}"})
+		mockStub.MockTransactionEnd(txId)
+	}
+}
+
+func Test_getHistoryByKey_legacy(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub(&queryresult.KeyModification{TxId: "mockTxID1", Value: []byte("{\"name\":\"legacy\"}"), Timestamp: &timestamp.Timestamp{Seconds: 1546300800}})
+	mockStub.key = "key1"
+	mockStub.Creator = newCertifiedCreator("Org1MSP", map[string]string{"zapier.auditor": "true"})
+	txId := "mockTxID"
+
+	args := []string{"key1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var history []historyEntry
+	if err := json.Unmarshal(response.GetPayload(), &history); err != nil || len(history) != 1 || history[0].TxId != "mockTxID1" {
+		fmt.Println("getHistoryByKey_legacy test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getKeyDetails_legacyDenied(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub(&queryresult.KeyModification{TxId: "mockTxID1", Value: []byte("{\"name\":\"legacy\"}"), Timestamp: &timestamp.Timestamp{Seconds: 1546300800}})
+	mockStub.key = "key1"
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"legacyTenant\":\"Org1MSP\"}")})
+	// Event saved by version 1.0.0 under its plain key
+	mockStub.State["key1"] = []byte("{\"name\":\"legacy\"}")
+	mockStub.Creator = newCreator("Org2MSP")
+	txId := "mockTxID"
+
+	args := []string{"key1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getKeyDetails(mockStub, args)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+	if response.GetStatus() != 400 || response.GetPayload() != nil {
+		fmt.Println("getKeyDetails_legacyDenied test failed")
+		t.FailNow()
+	}
+	response = simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	if response.GetStatus() != 400 || response.GetPayload() != nil {
+		fmt.Println("getKeyDetails_legacyDenied test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getKeyDetails_otherTenant(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.Creator = newCreator("Org1MSP")
+	mockStub.MockTransactionStart("mockTxID1")
+	simpleCC.saveNewEvent(mockStub, []string{"key1", "value1"})
+	mockStub.MockTransactionEnd("mockTxID1")
+
+	txId := "mockTxID"
+	mockStub.Creator = newCreator("Org2MSP")
+	for _, c := range []struct {
+		args   []string
+		status int32
+	}{
+		{[]string{"key1"}, 400},
+		{[]string{"key1", "Org1MSP"}, 403},
+	} {
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.getKeyDetails(mockStub, c.args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != c.status {
+			fmt.Println("getKeyDetails_otherTenant test failed")
+			t.FailNow()
+		}
+	}
+}
+
+func Test_getHistoryByKey_otherTenant(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := newHistoryStub()
+	mockStub.Creator = newCreator("Org2MSP")
+	txId := "mockTxID"
+
+	args := []string{"key1", "", "", "Org1MSP/team1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getHistoryByKey(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 403 {
+		fmt.Println("getHistoryByKey_otherTenant test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compactEvents(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"retentionPolicies\":[{\"keyPrefix\":\"device\",\"maxEvents\":1}]}")})
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2", "mockTxID3"} {
+		args := []string{"device1", "value" + fmt.Sprint(i+1), "stream1"}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(1000 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+	mockStub.MockTransactionStart("mockTxID4")
+	simpleCC.saveNewEvent(mockStub, []string{"other1", "value", "stream1"})
+	mockStub.MockTransactionEnd("mockTxID4")
+
+	// Only the two oldest events of device1 have expired, and one is removed
+	// per transaction
+	mockStub.Creator = newCertifiedCreator("Org1MSP", map[string]string{"zapier.auditor": "true"})
+	for i, expected := range []string{"mockTxID1", "mockTxID2"} {
+		txId := "mockTxID" + fmt.Sprint(i+5)
+		args := []string{"1"}
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.compactEvents(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		var result compactResult
+		if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Compacted != 1 || result.More != (i == 0) {
+			fmt.Println("compactEvents test failed")
+			t.FailNow()
+		}
+		summary := result.Summaries[0]
+		if summary.Count != 1 || summary.Events[0].TxId != expected || summary.MerkleRoot == "" {
+			fmt.Println("compactEvents test failed")
+			t.FailNow()
+		}
+		summaryKey, _ := mockStub.CreateCompositeKey(compactionIndex, []string{"", txId})
+		if mockStub.State[summaryKey] == nil {
+			fmt.Println("compactEvents test failed")
+			t.FailNow()
+		}
+	}
+
+	// the stream time index entries of the removed events are removed too
+	entries := 0
+	prefix, _ := rangeKey(mockStub, streamTimeIndex)
+	for key := range mockStub.State {
+		if strings.HasPrefix(key, prefix) {
+			entries++
+		}
+	}
+	if entries != 2 {
+		fmt.Println("compactEvents test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compactEvents_maxDays(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"retentionPolicies\":[{\"eventType\":\"Event\",\"maxDays\":1}]}")})
+
+	for i, event := range []string{"{\"docType\":\"Event\"}", "{\"docType\":\"Event\"}", "{\"docType\":\"Form\"}"} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		args := []string{"key" + fmt.Sprint(i+1), event}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(86400 * i)}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	txId := "mockTxID"
+	mockStub.Creator = newCertifiedCreator("Org1MSP", map[string]string{"zapier.auditor": "true"})
+	mockStub.MockTransactionStart(txId)
+	mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: 86400 + 3600}
+	response := simpleCC.compactEvents(mockStub, []string{})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// Only the Event saved more than a day ago has expired
+	if s := response.GetStatus(); s != 200 || tenantState(mockStub, "", "key1") != nil || tenantState(mockStub, "", "key2") == nil || tenantState(mockStub, "", "key3") == nil {
+		fmt.Println("compactEvents_maxDays test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compactEvents_retentionEntries(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"retentionPolicies\":[{\"keyPrefix\":\"device\",\"maxDays\":1}]}")})
+
+	// device1 is overwritten, so its first entry no longer expires it, and
+	// the policy is relaxed before the entry of device2 is due
+	for i, key := range []string{"device1", "device2", "device1"} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(86400 * i)}
+		simpleCC.saveNewEvent(mockStub, []string{key, "value" + fmt.Sprint(i+1)})
+		mockStub.MockTransactionEnd(txId)
+	}
+	mockStub.MockInit("mockTxID4", [][]byte{[]byte("init"), []byte("{\"retentionPolicies\":[{\"keyPrefix\":\"device\",\"maxDays\":30}]}")})
+	mockStub.Creator = newCertifiedCreator("Org1MSP", map[string]string{"zapier.auditor": "true"})
+
+	// The first transaction queues the entries of the two current events
+	// under the relaxed policy, and the second one removes no event
+	for _, expected := range []string{"{\"compacted\":0,\"reindexed\":2,\"more\":true,\"summaries\":[]}", "{\"compacted\":0,\"more\":false,\"summaries\":[]}"} {
+		txId := "mockTxID5"
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: 86400*2 + 3600}
+		response := simpleCC.compactEvents(mockStub, []string{})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if string(response.GetPayload()) != expected || tenantState(mockStub, "", "device1") == nil || tenantState(mockStub, "", "device2") == nil {
+			fmt.Println("compactEvents_retentionEntries test failed")
+			t.FailNow()
+		}
+	}
+	// The entry of the last event under the first policy, not yet due, and
+	// the entries queued under the relaxed policy remain
+	entries, _ := mockStub.GetStateByPartialCompositeKey(retentionIndex, []string{})
+	remaining := []string{}
+	for entries.HasNext() {
+		entry, _ := entries.Next()
+		_, attributes, _ := mockStub.SplitCompositeKey(entry.Key)
+		remaining = append(remaining, attributes[1])
+	}
+	if strings.Join(remaining, ",") != "mockTxID3,mockTxID2,mockTxID3" {
+		fmt.Println("compactEvents_retentionEntries test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compactEvents_policyAdded(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	// The events are saved before any policy is configured
+	for i, key := range []string{"device1", "device2"} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(86400 * i)}
+		simpleCC.saveNewEvent(mockStub, []string{key, "value" + fmt.Sprint(i+1)})
+		mockStub.MockTransactionEnd(txId)
+	}
+	mockStub.MockInit("mockTxID3", [][]byte{[]byte("init"), []byte("{\"retentionPolicies\":[{\"keyPrefix\":\"device\",\"maxDays\":1}]}")})
+	mockStub.Creator = newCertifiedCreator("Org1MSP", map[string]string{"zapier.auditor": "true"})
+
+	for i, expected := range []compactResult{{Reindexed: 1, More: true}, {Reindexed: 1, More: true}, {Compacted: 1}} {
+		txId := "mockTxID" + fmt.Sprint(i+4)
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: 86400 + 3600}
+		response := simpleCC.compactEvents(mockStub, []string{"1"})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		var result compactResult
+		if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Compacted != expected.Compacted || result.Reindexed != expected.Reindexed || result.More != expected.More {
+			fmt.Println("compactEvents_policyAdded test failed")
+			t.FailNow()
+		}
+	}
+	// Only the event saved more than a day ago has expired
+	if tenantState(mockStub, "", "device1") != nil || tenantState(mockStub, "", "device2") == nil {
+		fmt.Println("compactEvents_policyAdded test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compactEvents_forbidden(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.Creator = newCreator("Org1MSP")
+	txId := "mockTxID"
+
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.compactEvents(mockStub, []string{})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 403 {
+		fmt.Println("compactEvents_forbidden test failed")
+		t.FailNow()
+	}
+}
+
+func Test_compactEvents_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"1000"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.compactEvents(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("compactEvents_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getEventProof(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2", "mockTxID3"} {
+		args := []string{"key" + fmt.Sprint(i+1), "value" + fmt.Sprint(i+1)}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(1000 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	txId := "mockTxID"
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getEventProof(mockStub, []string{"key3", "mockTxID3"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// Events are only provable once anchored
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("getEventProof test failed")
+		t.FailNow()
+	}
+
+	mockStub.MockTransactionStart(txId)
+	response = simpleCC.anchorEvents(mockStub, []string{})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if !strings.HasPrefix(string(response.GetPayload()), "{\"anchored\":3,\"more\":false,\"batch\":1") {
+		fmt.Println("getEventProof test failed")
+		t.FailNow()
+	}
+
+	mockStub.MockTransactionStart(txId)
+	response = simpleCC.getEventProof(mockStub, []string{"key3", "mockTxID3"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var proof eventProof
+	if err := json.Unmarshal(response.GetPayload(), &proof); err != nil || proof.Batch != 1 || len(proof.Path) != 1 || !proof.Path[0].Left {
+		fmt.Println("getEventProof test failed")
+		t.FailNow()
+	}
+
+	proofAsString := string(response.GetPayload())
+	for event, valid := range map[string]bool{string(tenantState(mockStub, "", "key3")): true, "value3": false} {
+		mockStub.MockTransactionStart(txId)
+		response = simpleCC.verifyEventProof(mockStub, []string{event, proofAsString})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		var result verifyResult
+		if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Valid != valid || result.Root != proof.Root {
+			fmt.Println("getEventProof test failed")
+			t.FailNow()
+		}
+	}
+
+	// The leaf commits to the key and txID, so the proof of an event does not
+	// hold for another key or transaction
+	for _, tampered := range []eventProof{{Key: "key2", TxId: proof.TxId}, {Key: proof.Key, TxId: "mockTxID2"}} {
+		forged := proof
+		forged.Key, forged.TxId = tampered.Key, tampered.TxId
+		forgedAsBytes, _ := json.Marshal(forged)
+		mockStub.MockTransactionStart(txId)
+		response = simpleCC.verifyEventProof(mockStub, []string{string(tenantState(mockStub, "", "key3")), string(forgedAsBytes)})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Payload: " + string(response.GetPayload()))
+
+		var result verifyResult
+		if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Valid {
+			fmt.Println("getEventProof test failed")
+			t.FailNow()
+		}
+	}
+}
+
+func Test_anchorEvents_chain(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	var roots []string
+	for i, txId := range []string{"mockTxID1", "mockTxID2"} {
+		mockStub.MockTransactionStart(txId)
+		simpleCC.saveNewEvent(mockStub, []string{"key" + fmt.Sprint(i+1), "value"})
+		response := simpleCC.anchorEvents(mockStub, []string{})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		var result anchorResult
+		if err := json.Unmarshal(response.GetPayload(), &result); err != nil || result.Anchored != 1 || result.Batch != i+1 {
+			fmt.Println("anchorEvents_chain test failed")
+			t.FailNow()
+		}
+		roots = append(roots, result.Root)
+	}
+
+	// Each batch holds the root of the previous one, hashed into its own
+	batch, err := getBatch(mockStub, 2)
+	if err != nil || batch == nil || batch.PreviousRoot != roots[0] || batch.Root != roots[1] {
+		fmt.Println("anchorEvents_chain test failed")
+		t.FailNow()
+	}
+	previousRoot, _ := hex.DecodeString(batch.PreviousRoot)
+	treeRoot, _ := hex.DecodeString(batch.TreeRoot)
+	if batch.TreeRoot == batch.Root || hex.EncodeToString(hashBatchRoot(previousRoot, treeRoot)) != batch.Root {
+		fmt.Println("anchorEvents_chain test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_eventType(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"key1", "{\"name\":\"value1\"}", "", "", "", "form"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	// By default the stored event is emitted
+	event := <-mockStub.ChaincodeEventsChannel
+	if event.EventName != "zapier.form" || string(event.Payload) != string(tenantState(mockStub, "", "key1")) {
+		fmt.Println("saveNewEvent_eventType test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_emitHash(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"eventNamePrefix\":\"forms.\",\"eventEmit\":\"hash\"}")})
+	txId := "mockTxID"
+
+	args := []string{"key1", "{\"name\":\"value1\"}", "", "", "", "form"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	event := <-mockStub.ChaincodeEventsChannel
+	var emitted map[string]interface{}
+	if err := json.Unmarshal(event.Payload, &emitted); err != nil || event.EventName != "forms.form" || emitted["key"] != "key1" || emitted["hash"] == nil || emitted["name"] != nil {
+		fmt.Println("saveNewEvent_emitHash test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_emptyEventNamePrefix(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockInit("mockTxID", [][]byte{[]byte("init"), []byte("{\"eventNamePrefix\":\"\"}")})
+	txId := "mockTxID"
+
+	args := []string{"key1", "{\"name\":\"value1\"}", "", "", "", "form"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	event := <-mockStub.ChaincodeEventsChannel
+	if event.EventName != "form" {
+		fmt.Println("saveNewEvent_emptyEventNamePrefix test failed")
+		t.FailNow()
+	}
+}
+
+func Test_saveNewEvent_invalidEventType(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"key1", "value1", "", "", "", "form submitted"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.saveNewEvent(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("saveNewEvent_invalidEventType test failed")
+		t.FailNow()
+	}
+}
+
+func Test_subscribe(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+
+	mockStub.MockTransactionStart("mockSubscriptionID")
+	response := simpleCC.subscribe(mockStub, []string{"form*", "hook1"})
+	mockStub.MockTransactionEnd("mockSubscriptionID")
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 200 {
+		fmt.Println("subscribe test failed")
+		t.FailNow()
+	}
+
+	for i, eventType := range []string{"form.created", "device", "form.updated"} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		args := []string{"key" + fmt.Sprint(i+1), "value", "", "", "", eventType}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(1000 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	// Only the events matching the filter are pending
+	txId := "mockTxID"
+	mockStub.MockTransactionStart(txId)
+	response = simpleCC.getPendingEvents(mockStub, []string{"mockSubscriptionID"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var page pendingPage
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 2 || page.Events[0].TxId != "mockTxID1" || page.Events[1].TxId != "mockTxID3" || page.LastAcked != nil {
+		fmt.Println("subscribe test failed")
+		t.FailNow()
+	}
+
+	mockStub.MockTransactionStart(txId)
+	response = simpleCC.ackEvents(mockStub, []string{"mockSubscriptionID", "mockTxID1"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if string(response.GetPayload()) != "{\"removed\":1}" {
+		fmt.Println("subscribe test failed")
+		t.FailNow()
+	}
+
+	mockStub.MockTransactionStart(txId)
+	response = simpleCC.getPendingEvents(mockStub, []string{"mockSubscriptionID"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	page = pendingPage{}
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 1 || page.LastAcked == nil || page.LastAcked.TxId != "mockTxID1" {
+		fmt.Println("subscribe test failed")
+		t.FailNow()
+	}
+
+	mockStub.MockTransactionStart(txId)
+	response = simpleCC.unsubscribe(mockStub, []string{"mockSubscriptionID"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if string(response.GetPayload()) != "{\"removed\":1}" {
+		fmt.Println("subscribe test failed")
+		t.FailNow()
+	}
+}
+
+func Test_ackEvents_notPending(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.MockTransactionStart("mockSubscriptionID")
+	simpleCC.subscribe(mockStub, []string{"", "hook1"})
+	mockStub.MockTransactionEnd("mockSubscriptionID")
+	txId := "mockTxID"
+
+	args := []string{"mockSubscriptionID", "mockTxID1"}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.ackEvents(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("ackEvents_notPending test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getPendingEvents_otherTenant(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.Creator = newCreator("Org1MSP")
+	mockStub.MockTransactionStart("mockSubscriptionID")
+	simpleCC.subscribe(mockStub, []string{"", "hook1"})
+	mockStub.MockTransactionEnd("mockSubscriptionID")
+	txId := "mockTxID"
+
+	// The subscription is not found in the tenant of the caller, and the
+	// tenant of the subscription may not be passed
+	mockStub.Creator = newCreator("Org2MSP")
+	for _, c := range []struct {
+		args   []string
+		status int32
+	}{
+		{[]string{"mockSubscriptionID"}, 400},
+		{[]string{"mockSubscriptionID", "", "Org1MSP"}, 403},
+	} {
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.getPendingEvents(mockStub, c.args)
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		if s := response.GetStatus(); s != c.status {
+			fmt.Println("getPendingEvents_otherTenant test failed")
+			t.FailNow()
+		}
+	}
+}
+
+func Test_subscribe_tenants(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.Creator = newCreator("Org1MSP")
+	mockStub.MockTransactionStart("mockSubscriptionID")
+	simpleCC.subscribe(mockStub, []string{"", "hook1"})
+	mockStub.MockTransactionEnd("mockSubscriptionID")
+
+	for i, mspID := range []string{"Org2MSP", "Org1MSP"} {
+		txId := "mockTxID" + fmt.Sprint(i+1)
+		mockStub.Creator = newCreator(mspID)
+		mockStub.MockTransactionStart(txId)
+		simpleCC.saveNewEvent(mockStub, []string{"key1", "value"})
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	// Only the event of the tenant of the subscription is queued, and an
+	// auditor may read the subscription by naming its tenant
+	txId := "mockTxID"
+	mockStub.Creator = newCertifiedCreator("Org2MSP", map[string]string{"zapier.auditor": "true"})
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getPendingEvents(mockStub, []string{"mockSubscriptionID", "", "Org1MSP"})
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var page pendingPage
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 1 || page.Events[0].TxId != "mockTxID2" {
+		fmt.Println("subscribe_tenants test failed")
+		t.FailNow()
+	}
+}
+
+func Test_unsubscribe_otherTenant(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	mockStub.Creator = newCreator("Org1MSP")
+	mockStub.MockTransactionStart("mockSubscriptionID")
+	simpleCC.subscribe(mockStub, []string{"", "hook1"})
+	mockStub.MockTransactionEnd("mockSubscriptionID")
+	mockStub.MockTransactionStart("mockTxID1")
+	simpleCC.saveNewEvent(mockStub, []string{"key1", "value"})
+	mockStub.MockTransactionEnd("mockTxID1")
+
+	// Another tenant cannot remove the subscription
+	mockStub.Creator = newCreator("Org2MSP")
+	mockStub.MockTransactionStart("mockTxID2")
+	response := simpleCC.unsubscribe(mockStub, []string{"mockSubscriptionID"})
+	mockStub.MockTransactionEnd("mockTxID2")
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Message: " + response.GetMessage())
+	mockStub.Creator = newCreator("Org1MSP")
+	mockStub.MockTransactionStart("mockTxID3")
+	pending := simpleCC.getPendingEvents(mockStub, []string{"mockSubscriptionID"})
+	mockStub.MockTransactionEnd("mockTxID3")
+	var page pendingPage
+	if err := json.Unmarshal(pending.GetPayload(), &page); err != nil || response.GetStatus() != 400 || len(page.Events) != 1 {
+		fmt.Println("unsubscribe_otherTenant test failed")
+		t.FailNow()
+	}
+
+	// A previous unsubscribe of Org1MSP removed the subscription but left
+	// its queued event
+	subscriptionKey, _ := mockStub.CreateCompositeKey(subscriptionIndex, []string{"Org1MSP", "mockSubscriptionID"})
+	unsubscribedKey, _ := mockStub.CreateCompositeKey(unsubscribedIndex, []string{"Org1MSP", "mockSubscriptionID"})
+	delete(mockStub.State, subscriptionKey)
+	mockStub.State[unsubscribedKey] = []byte{0x00}
+	queueKey, _ := mockStub.CreateCompositeKey(queueIndex, []string{"Org1MSP", "mockSubscriptionID"})
+
+	// Another tenant can neither find the subscription nor reach its queue,
+	// while its own tenant removes the remaining event
+	txId := "mockTxID"
+	for _, c := range []struct {
+		mspID   string
+		status  int32
+		removed int
+	}{
+		{"Org2MSP", 400, 0},
+		{"Org1MSP", 200, 1},
+	} {
+		mockStub.Creator = newCreator(c.mspID)
+		mockStub.MockTransactionStart(txId)
+		response := simpleCC.unsubscribe(mockStub, []string{"mockSubscriptionID"})
+		mockStub.MockTransactionEnd(txId)
+		fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+		fmt.Println("Payload: " + string(response.GetPayload()))
+		fmt.Println("Message: " + response.GetMessage())
+
+		queued := 0
+		for key := range mockStub.State {
+			if strings.HasPrefix(key, queueKey) {
+				queued++
+			}
+		}
+		if response.GetStatus() != c.status || queued != 1-c.removed {
+			fmt.Println("unsubscribe_otherTenant test failed")
+			t.FailNow()
+		}
+	}
+	if mockStub.State[unsubscribedKey] != nil {
+		fmt.Println("unsubscribe_otherTenant test failed")
+		t.FailNow()
+	}
+}
+
+func Test_subscribe_incorrectArgs(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := shim.NewMockStub("mockstub", simpleCC)
+	txId := "mockTxID"
+
+	args := []string{"form*", ""}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.subscribe(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	if s := response.GetStatus(); s != 400 {
+		fmt.Println("subscribe_incorrectArgs test failed")
+		t.FailNow()
+	}
+}
+
+func Test_getEventsByStream_pagination(t *testing.T) {
+	simpleCC := new(SimpleAsset)
+	mockStub := &paginationStub{MockStub: shim.NewMockStub("mockstub", simpleCC)}
+
+	for i, txId := range []string{"mockTxID1", "mockTxID2", "mockTxID3", "mockTxID4", "mockTxID5"} {
+		args := []string{"key1", "{\"count\":" + fmt.Sprint(i+1) + "}", "stream1"}
+		mockStub.MockTransactionStart(txId)
+		mockStub.TxTimestamp = &timestamp.Timestamp{Seconds: int64(1000 * (i + 1))}
+		simpleCC.saveNewEvent(mockStub, args)
+		mockStub.MockTransactionEnd(txId)
+	}
+
+	// the first two events are out of range and must not use up the page,
+	// which lists the newest events first
+	txId := "mockTxID"
+	args := []string{"stream1", "1970-01-01T00:50:00Z", "", "2", ""}
+	mockStub.MockTransactionStart(txId)
+	response := simpleCC.getEventsByStream(mockStub, args)
+	fmt.Println("Status: " + fmt.Sprint(response.GetStatus()))
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	fmt.Println("Message: " + response.GetMessage())
+
+	var page eventsPage
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 2 || page.FetchedRecordsCount != 2 {
+		fmt.Println("getEventsByStream_pagination test failed")
+		t.FailNow()
+	}
+	if page.Events[0].TxId != "mockTxID5" || page.Events[1].TxId != "mockTxID4" {
+		fmt.Println("getEventsByStream_pagination test failed")
+		t.FailNow()
+	}
+
+	args = []string{"stream1", "1970-01-01T00:50:00Z", "", "2", page.Bookmark}
+	response = simpleCC.getEventsByStream(mockStub, args)
+	mockStub.MockTransactionEnd(txId)
+	fmt.Println("Payload: " + string(response.GetPayload()))
+	page = eventsPage{}
+	if err := json.Unmarshal(response.GetPayload(), &page); err != nil || len(page.Events) != 1 || page.Events[0].TxId != "mockTxID3" {
+		fmt.Println("getEventsByStream_pagination test failed")
+		t.FailNow()
+	}
+}